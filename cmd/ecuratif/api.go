@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"e-curatif/internal/data"
+	"e-curatif/internal/validator"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ############
+// API Handlers
+// ############
+
+// Every info sent by the API carries its version as ETag. A client must send
+// it back with If-Match when updating the info, so an update made on an info
+// modified in the meantime is refused with a 409 status.
+
+// etag() formats the info version as a strong ETag.
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ifMatch() reads the version sent with the If-Match header.
+// ok is false if the header is missing or isn't a version sent by etag().
+func ifMatch(r *http.Request) (version int, ok bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	value = strings.TrimPrefix(value, "W/")
+
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return 0, false
+	}
+
+	version, err = strconv.Atoi(unquoted)
+	if err != nil {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// infoShowAPI() sends the info as JSON with its version as ETag.
+func (app *application) infoShowAPI(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		app.errorResponse(w, r, http.StatusNotFound, "info not found")
+		return
+	}
+
+	info, err := app.infos.Data(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.errorResponse(w, r, http.StatusNotFound, "info not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", etag(info.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"info": info}, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// infoUpdateAPI() replaces the info with the one sent as JSON. The If-Match
+// header is required and must hold the ETag sent by infoShowAPI().
+func (app *application) infoUpdateAPI(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		app.errorResponse(w, r, http.StatusNotFound, "info not found")
+		return
+	}
+
+	version, ok := ifMatch(r)
+	if !ok {
+		app.errorResponse(w, r, http.StatusPreconditionRequired,
+			"the If-Match header must hold the info ETag")
+		return
+	}
+
+	var input struct {
+		Agent    string `json:"agent"`
+		Material string `json:"material"`
+		Priority int    `json:"priority"`
+		Target   string `json:"target"`
+		Rte      string `json:"rte"`
+		Detail   string `json:"detail"`
+		Estimate string `json:"estimate"`
+		Brips    string `json:"brips"`
+		Oups     string `json:"oups"`
+		Ameps    string `json:"ameps"`
+		Ais      string `json:"ais"`
+		Status   string `json:"status"`
+		Event    string `json:"event"`
+		Doneby   string `json:"doneby"`
+
+		EquipmentID int `json:"equipment_id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.New()
+
+	emptyField := "must not be empty"
+
+	v.CheckField(validator.NotBlank(input.Agent), "agent", emptyField)
+	v.CheckField(validator.NotBlank(input.Material), "material", emptyField)
+	v.CheckField(validator.NotBlank(input.Detail), "detail", emptyField)
+	v.CheckField(validator.NotBlank(input.Event), "event", emptyField)
+	v.CheckField(validator.NotBlank(input.Status), "status", emptyField)
+	v.CheckField(input.Priority > 0, "priority", "must be greater than 0")
+	v.CheckField(input.Target == "" ||
+		validator.IsDate(input.Target, data.DateLayout),
+		"target", "must be a date (YYYY-MM-DD)")
+	v.CheckField(input.EquipmentID >= 0, "equipment_id",
+		"must not be negative")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.FieldErrors)
+		return
+	}
+
+	info := &data.Info{
+		ID:       id,
+		Version:  version,
+		Agent:    input.Agent,
+		Material: input.Material,
+		Priority: input.Priority,
+		Rte:      input.Rte,
+		Detail:   input.Detail,
+		Estimate: input.Estimate,
+		Brips:    input.Brips,
+		Oups:     input.Oups,
+		Ameps:    input.Ameps,
+		Ais:      input.Ais,
+		Status:   input.Status,
+		Event:    input.Event,
+		Doneby:   input.Doneby,
+
+		EquipmentID: input.EquipmentID,
+	}
+
+	info.Target, _ = data.ParseDate(input.Target)
+
+	// The info before the change tells which emails are due.
+	before, err := app.infos.Data(r.Context(), id)
+	if err != nil && !errors.Is(err, data.ErrNoRows) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The equipment must be in the catalogue of the source of the info.
+	if info.EquipmentID > 0 {
+		e, err := app.equipment.Data(r.Context(), info.EquipmentID)
+		if err != nil && !errors.Is(err, data.ErrNoRows) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if e == nil || (before != nil && e.SourceID != before.SourceID) {
+			app.failedValidationResponse(w, r, map[string]string{
+				"equipment_id": "must be an equipment of the source"})
+			return
+		}
+
+		info.Equipment = e.Name
+	}
+
+	err = app.infos.Update(r.Context(), info)
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.infoConflictAPI(w, r, id)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	if before != nil {
+		logger := app.requestLogger(r)
+
+		info.SourceID = before.SourceID
+		app.notifyInfo(r.Context(), logger, before, info)
+		app.infoEvents(r.Context(), logger, before, info)
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", etag(info.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"info": info}, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// infoConflictAPI() is the API version of infoConflict(). The current info
+// is sent with its ETag so the client can merge and retry.
+func (app *application) infoConflictAPI(w http.ResponseWriter, r *http.Request,
+	id int) {
+
+	current, err := app.infos.Data(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.errorResponse(w, r, http.StatusNotFound, "info not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", etag(current.Version))
+
+	env := envelope{
+		"error": newAPIError(r, http.StatusConflict,
+			"the info has been modified since it was read"),
+		"info": current,
+	}
+
+	err = app.writeJSON(w, http.StatusConflict, env, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// searchAPI() is the API version of the search page. The criteria are the
+// same, plus "limit" (50 by default, 200 max).
+// Exemple: GET /api/v1/search?q=disjoncteur&status=affecté&limit=20
+func (app *application) searchAPI(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	form, filters := readSearch(qs)
+
+	if l := qs.Get("limit"); l != "" {
+		form.CheckField(validator.IsNumber(l), "limit", "must be a number")
+		filters.Limit, _ = strconv.Atoi(l)
+	}
+
+	if !form.Valid() {
+		app.failedValidationResponse(w, r, form.FieldErrors)
+		return
+	}
+
+	results, err := app.infos.Search(r.Context(), filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// sourceInput is the JSON body of sourceCreateAPI() and sourceUpdateAPI().
+type sourceInput struct {
+	Name         string   `json:"name"`
+	CodeGMAO     string   `json:"code_GMAO"`
+	ArchiveAfter *int     `json:"archive_after"`
+	VoltageKV    int      `json:"voltage_kv"`
+	Address      string   `json:"address"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	Team         string   `json:"team"`
+	Notes        string   `json:"notes"`
+}
+
+// readSourceAPI() reads and checks the source sent as JSON. The response is
+// already sent when ok is false.
+func (app *application) readSourceAPI(w http.ResponseWriter,
+	r *http.Request) (src *data.Source, ok bool) {
+
+	var input sourceInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	src = &data.Source{
+		Name:         strings.TrimSpace(input.Name),
+		CodeGMAO:     normalizeCodeGMAO(input.CodeGMAO),
+		ArchiveAfter: input.ArchiveAfter,
+		VoltageKV:    input.VoltageKV,
+		Address:      strings.TrimSpace(input.Address),
+		Latitude:     input.Latitude,
+		Longitude:    input.Longitude,
+		Team:         strings.TrimSpace(input.Team),
+		Notes:        strings.TrimSpace(input.Notes),
+	}
+
+	v := validator.New()
+
+	v.CheckField(validator.NotBlank(src.Name), "name", "must not be empty")
+	v.CheckField(src.CodeGMAO == "" || validator.Matches(src.CodeGMAO, codeGMAORX),
+		"code_GMAO", "must be 2 to 20 letters, digits, - or _")
+	v.CheckField(src.ArchiveAfter == nil || *src.ArchiveAfter >= 0,
+		"archive_after", "must not be negative")
+	v.CheckField(src.VoltageKV >= 0, "voltage_kv", "must not be negative")
+	v.CheckField(validCoordinates(src.Latitude, src.Longitude), "latitude",
+		"latitude (-90 to 90) and longitude (-180 to 180) go together")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.FieldErrors)
+		return nil, false
+	}
+
+	return src, true
+}
+
+// sourceErrorAPI() sends the error of SourceStore.Insert() or Update().
+func (app *application) sourceErrorAPI(w http.ResponseWriter, r *http.Request,
+	err error) {
+
+	switch {
+	case errors.Is(err, data.ErrNoRows):
+		app.errorResponse(w, r, http.StatusNotFound, "source not found")
+	case errors.Is(err, data.ErrDuplicate):
+		app.failedValidationResponse(w, r,
+			map[string]string{"name": "is already used"})
+	case errors.Is(err, data.ErrDuplicateCode):
+		app.failedValidationResponse(w, r,
+			map[string]string{"code_GMAO": "is already used"})
+	default:
+		app.serverError(w, r, err)
+	}
+}
+
+// sourceShowAPI() sends the source with its metadata as JSON.
+func (app *application) sourceShowAPI(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		app.errorResponse(w, r, http.StatusNotFound, "source not found")
+		return
+	}
+
+	src, err := app.sources.Data(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.errorResponse(w, r, http.StatusNotFound, "source not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"source": src}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// sourceCreateAPI() creates the source sent as JSON. Its URL is sent in the
+// Location header.
+func (app *application) sourceCreateAPI(w http.ResponseWriter, r *http.Request) {
+	src, ok := app.readSourceAPI(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := app.sources.Insert(r.Context(), src)
+	if err != nil {
+		app.sourceErrorAPI(w, r, err)
+		return
+	}
+
+	app.sourceEvent(r.Context(), app.requestLogger(r), data.EventSourceCreated,
+		src)
+
+	headers := http.Header{}
+	headers.Set("Location", fmt.Sprintf("/api/v1/source/%d", src.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"source": src}, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// sourceUpdateAPI() replaces the source with the one sent as JSON.
+func (app *application) sourceUpdateAPI(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		app.errorResponse(w, r, http.StatusNotFound, "source not found")
+		return
+	}
+
+	src, ok := app.readSourceAPI(w, r)
+	if !ok {
+		return
+	}
+
+	src.ID = id
+
+	err = app.sources.Update(r.Context(), src)
+	if err != nil {
+		app.sourceErrorAPI(w, r, err)
+		return
+	}
+
+	app.sourceEvent(r.Context(), app.requestLogger(r), data.EventSourceUpdated,
+		src)
+
+	// Fetched again for the fields Update() doesn't set, like created.
+	src, err = app.sources.Data(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"source": src}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// assets serves the files of static/. Their URL contains a hash of their
+// content (css/main.css => /static/css/main.3f2a1b4c.css), so they can be
+// cached forever by the browser: a modified file gets a new URL.
+//
+// When the files are read from disk (dev mode), they are served under their
+// own name without cache, so a change is seen right away.
+type assets struct {
+	fsys fs.FS
+	dev  bool
+
+	// logical name => hashed name, and the opposite.
+	hashed  map[string]string
+	logical map[string]string
+}
+
+// newAssets() hashes every file of static/ in fsys.
+func newAssets(fsys fs.FS, dev bool) (*assets, error) {
+	a := &assets{
+		fsys:    fsys,
+		dev:     dev,
+		hashed:  map[string]string{},
+		logical: map[string]string{},
+	}
+
+	if dev {
+		return a, nil
+	}
+
+	err := fs.WalkDir(fsys, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		name := strings.TrimPrefix(p, "static/")
+		ext := path.Ext(name)
+
+		h := strings.TrimSuffix(name, ext) + "." +
+			hex.EncodeToString(sum[:4]) + ext
+
+		a.hashed[name] = h
+		a.logical[h] = name
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// url() returns the URL of a static file used by the templates.
+// Exemple: {{asset "css/main.css"}}
+func (a *assets) url(name string) string {
+	if h, ok := a.hashed[name]; ok {
+		return "/static/" + h
+	}
+
+	return "/static/" + name
+}
+
+// serve() handles GET /static/*. A hashed name is cached for a year, any
+// other name (dev mode, or a link to the plain name) must be revalidated.
+func (a *assets) serve(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "*")
+	cache := "no-cache"
+
+	if logical, ok := a.logical[name]; ok {
+		name = logical
+		cache = "public, max-age=31536000, immutable"
+	}
+
+	content, err := fs.ReadFile(a.fsys, path.Join("static", name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", cache)
+
+	// The embedded files have no modification time, ServeContent then
+	// relies on the ETag only.
+	w.Header().Set("ETag", `"`+contentHash(content)+`"`)
+
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// contentHash() returns the first bytes of the SHA-256 of content, in hex.
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct that holds all configuration settings for the app.
+// Filled by loadConfig() when the app starts.
+type config struct {
+	// The ony purpose of env is to announce if the app runs as development
+	// or production
+	env string
+
+	// maxIdleTime is the duration of each idle connexion before beeing
+	// shutdown.
+	// maxOpenConns is the max number of open connexions.
+	// maxIdleConns is the number of connexions kept open even when idle.
+	// maxLifetime is the duration before a connexion is closed and
+	// replaced, healthCheck the time between two checks of idle connexions.
+	// connectTimeout is used for each new connexion and for the startup
+	// ping.
+	db struct {
+		dsn            string        // DB DSN
+		maxIdleTime    string        // MaxConnIdleTime pgx equiv
+		maxOpenConns   int           // MaxConns pgx equiv
+		maxIdleConns   int           // MinConns pgx equiv
+		maxLifetime    time.Duration // MaxConnLifetime pgx equiv
+		healthCheck    time.Duration // HealthCheckPeriod pgx equiv
+		connectTimeout time.Duration // ConnectTimeout pgx equiv
+
+		// Apply pending migrations when the app starts.
+		automigrate bool
+	}
+	// DB port (PSQL default: 5432)
+	port string
+
+	// after is the number of days a resolved info stays before beeing
+	// archived (0 disables it), unless the source has its own value.
+	// interval is the time between two runs of the archiving job.
+	archive struct {
+		after    int
+		interval time.Duration
+	}
+
+	// Max time given to the running requests and background jobs to finish
+	// once the app received SIGINT or SIGTERM.
+	shutdownTimeout time.Duration
+
+	// format is the slog handler used: "text" or "json".
+	log struct {
+		format string
+	}
+
+	// Name of the header holding the user name, set by the reverse proxy
+	// doing the authentication. teamHeader holds the team of the user, the
+	// saved views are shared with it.
+	authHeader string
+	teamHeader string
+
+	// Directory holding html/ and static/, read instead of the embedded
+	// files. Used in development, with live reload.
+	uiDir string
+
+	// URL of the app as seen by the users, used by the links of the
+	// emails.
+	baseURL string
+
+	// SMTP server of the notifications. Without username there's no
+	// authentication (local stand-in like cmd/smtpsink). interval is the
+	// time between two runs of the mail worker, 0 disables the emails.
+	// maxAttempts is the number of tries before an email is given up.
+	// overdueInterval is the time between two checks of the overdue infos.
+	smtp struct {
+		host            string
+		port            int
+		username        string
+		password        string
+		sender          string
+		interval        time.Duration
+		maxAttempts     int
+		overdueInterval time.Duration
+	}
+
+	// Webhooks delivery worker: interval is the time between two runs, 0
+	// disables the webhooks. timeout bounds each call, maxAttempts is the
+	// number of tries before a delivery is given up.
+	webhook struct {
+		interval    time.Duration
+		timeout     time.Duration
+		maxAttempts int
+	}
+
+	// GMAO connector: "none", "http" (url, token, timeout), "file" (outDir
+	// and inDir) or "fake" (in memory, for development). interval is the
+	// time between two synchronizations.
+	gmao struct {
+		connector string
+		url       string
+		token     string
+		timeout   time.Duration
+		outDir    string
+		inDir     string
+		interval  time.Duration
+	}
+
+	// Digest emails, queued once hour (local time) is past: every day for
+	// the daily ones, on weekday for the weekly ones. size is the number of
+	// overdue and oldest infos listed per source.
+	digest struct {
+		hour    int
+		day     string
+		weekday time.Weekday
+		size    int
+	}
+}
+
+// Prefix of the environment variables. Each flag has its own variable, named
+// after the flag in upper case with "_" instead of "-".
+// Exemple: -db-max-open-conns => ECURATIF_DB_MAX_OPEN_CONNS
+const envPrefix = "ECURATIF_"
+
+// loadConfig() reads the settings and returns the remaining arguments (like
+// "migrate up"). Each setting is taken from, by order of precedence:
+//
+//  1. the command line flag
+//  2. the ECURATIF_* environment variable
+//  3. the config file given by -config (or ECURATIF_CONFIG)
+//  4. the default value of the flag
+//
+// The settings are validated before being returned.
+func loadConfig(args []string) (config, []string, error) {
+	var cfg config
+
+	fs := flag.NewFlagSet("ecuratif", flag.ContinueOnError)
+
+	var configFile string
+	fs.StringVar(&configFile, "config", "", "Config file (TOML), overridden by env variables and flags")
+
+	// This flags have default values for dev and prod.
+	// flag "port" it's for localhost only!
+	fs.StringVar(&cfg.port, "port", ":3001", "E-Curatif server port")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+
+	// The default values are the minimum recommended.
+	// see: https://pgtune.leopard.in.ua/ for more info
+	// db-dsn string flag is empty on purpose.
+	// See: See Makefile to check the DB DSN.
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 20, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 20, "PostgreSQL connections kept open when idle")
+	fs.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	fs.DurationVar(&cfg.db.maxLifetime, "db-max-lifetime", time.Hour, "PostgreSQL max connection lifetime")
+	fs.DurationVar(&cfg.db.healthCheck, "db-health-check-period", time.Minute, "PostgreSQL idle connections health check period")
+	fs.DurationVar(&cfg.db.connectTimeout, "db-connect-timeout", 5*time.Second, "PostgreSQL connect and startup ping timeout")
+	fs.BoolVar(&cfg.db.automigrate, "db-automigrate", false, "Apply pending migrations on startup")
+
+	fs.IntVar(&cfg.archive.after, "archive-after", 30, "Days before a resolved info is archived (0 to disable)")
+	fs.DurationVar(&cfg.archive.interval, "archive-interval", 24*time.Hour, "Time between two archiving runs")
+
+	fs.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 30*time.Second, "Max time to drain requests and jobs on shutdown")
+
+	fs.StringVar(&cfg.log.format, "log-format", "text", "Log format (text|json)")
+	fs.StringVar(&cfg.uiDir, "ui-dir", "", "Read templates and static files from this directory instead of the embedded ones (development)")
+	fs.StringVar(&cfg.authHeader, "auth-header", "X-Remote-User", "Header set by the authenticating reverse proxy with the user name")
+	fs.StringVar(&cfg.teamHeader, "auth-team-header", "X-Remote-Group", "Header set by the authenticating reverse proxy with the user team")
+	fs.StringVar(&cfg.baseURL, "base-url", "http://localhost:3001", "URL of the app used by the links of the emails")
+
+	// Defaults to a local SMTP stand-in, see cmd/smtpsink.
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 1025, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username (no authentication if empty)")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "E-Curatif <no-reply@e-curatif.local>", "From header of the emails")
+	fs.DurationVar(&cfg.smtp.interval, "smtp-interval", 30*time.Second, "Time between two runs of the mail worker (0 disables the emails)")
+	fs.IntVar(&cfg.smtp.maxAttempts, "smtp-max-attempts", 5, "Number of tries before an email is given up")
+	fs.DurationVar(&cfg.smtp.overdueInterval, "smtp-overdue-interval", time.Hour, "Time between two checks of the overdue curatifs")
+
+	fs.DurationVar(&cfg.webhook.interval, "webhook-interval", 10*time.Second, "Time between two runs of the webhooks worker (0 disables the webhooks)")
+	fs.DurationVar(&cfg.webhook.timeout, "webhook-timeout", 10*time.Second, "Timeout of each webhook call")
+	fs.IntVar(&cfg.webhook.maxAttempts, "webhook-max-attempts", 8, "Number of tries before a webhook delivery is given up")
+
+	fs.StringVar(&cfg.gmao.connector, "gmao-connector", "none", "GMAO connector (none|http|file|fake)")
+	fs.StringVar(&cfg.gmao.url, "gmao-url", "", "URL of the GMAO API (http connector)")
+	fs.StringVar(&cfg.gmao.token, "gmao-token", "", "Bearer token of the GMAO API (http connector)")
+	fs.DurationVar(&cfg.gmao.timeout, "gmao-timeout", 30*time.Second, "Timeout of each call to the GMAO API (http connector)")
+	fs.StringVar(&cfg.gmao.outDir, "gmao-out-dir", "", "Directory where the work requests are written (file connector)")
+	fs.StringVar(&cfg.gmao.inDir, "gmao-in-dir", "", "Directory where the GMAO drops the work order statuses (file connector)")
+	fs.DurationVar(&cfg.gmao.interval, "gmao-interval", 5*time.Minute, "Time between two synchronizations with the GMAO")
+
+	fs.IntVar(&cfg.digest.hour, "digest-hour", 7, "Hour (0-23, local time) the digest emails are sent")
+	fs.StringVar(&cfg.digest.day, "digest-weekday", "monday", "Day the weekly digest emails are sent")
+	fs.IntVar(&cfg.digest.size, "digest-size", 5, "Number of overdue and oldest curatifs listed per source in the digests")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	// Flags given on the command line must not be overridden.
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if !explicit["config"] {
+		configFile = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	if configFile != "" {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			return cfg, nil, err
+		}
+
+		// The env variables are applied after the file, so they win.
+		for name := range values {
+			if os.Getenv(envName(name)) != "" {
+				delete(values, name)
+			}
+		}
+
+		err = setFlags(fs, explicit, values, configFile)
+		if err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	env := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if v := os.Getenv(envName(f.Name)); v != "" && f.Name != "config" {
+			env[f.Name] = v
+		}
+	})
+
+	err = setFlags(fs, explicit, env, "environment")
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	err = cfg.validate()
+	if err != nil {
+		return cfg, nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// envName() returns the env variable of a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// setFlags() sets every flag of values which isn't in explicit. from is the
+// origin of the values, used in the error messages.
+func setFlags(fs *flag.FlagSet, explicit map[string]bool,
+	values map[string]string, from string) error {
+
+	for name, value := range values {
+		if explicit[name] {
+			continue
+		}
+
+		err := fs.Set(name, value)
+		if err != nil {
+			if fs.Lookup(name) == nil {
+				return fmt.Errorf("%s: unknown setting %q", from, name)
+			}
+
+			return fmt.Errorf("%s: invalid value %q for %s: %w", from, value,
+				name, err)
+		}
+	}
+
+	return nil
+}
+
+// readConfigFile() reads a config file written in a subset of TOML: one
+// "key = value" per line, "#" comments and "[section]" tables. The keys are
+// the flag names, a table being the first part of the name.
+// Exemple:
+//
+//	env = "production"
+//
+//	[db]
+//	dsn = "postgres://ecuratif@localhost/ecuratif"
+//	max_open_conns = 40
+//
+// sets -env, -db-dsn and -db-max-open-conns. "_" and "-" are the same in keys.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+func parseConfig(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid table %q", n, line)
+			}
+
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		if section != "" {
+			key = strings.ReplaceAll(section, "_", "-") + "-" + key
+		}
+
+		value, err := parseValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		values[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// parseValue() unquotes the strings and removes the comment ending the line.
+// Numbers, booleans and durations are kept as they are for flag.Set().
+func parseValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		end := strings.LastIndex(v, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", v)
+		}
+
+		return strconv.Unquote(v[:end+1])
+	case strings.HasPrefix(v, "'"):
+		end := strings.LastIndex(v, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", v)
+		}
+
+		return v[1:end], nil
+	}
+
+	if i := strings.Index(v, "#"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+
+	if v == "" {
+		return "", errors.New("missing value")
+	}
+
+	return v, nil
+}
+
+// validate() checks every setting and returns all the errors at once. It
+// also sets the values parsed from the strings, like digest.weekday.
+func (cfg *config) validate() error {
+	var errs []error
+
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.env == "development" || cfg.env == "staging" ||
+		cfg.env == "production",
+		"env: must be development, staging or production (got %q)", cfg.env)
+
+	check(cfg.port != "", "port: must be provided")
+	check(cfg.db.dsn != "", "db-dsn: must be provided (or %s)",
+		envName("db-dsn"))
+	check(cfg.db.maxOpenConns > 0, "db-max-open-conns: must be greater than 0")
+	check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns: must not be negative")
+
+	_, err := time.ParseDuration(cfg.db.maxIdleTime)
+	check(err == nil, "db-max-idle-time: invalid duration %q", cfg.db.maxIdleTime)
+
+	check(cfg.db.maxLifetime > 0, "db-max-lifetime: must be greater than 0")
+	check(cfg.db.healthCheck > 0, "db-health-check-period: must be greater than 0")
+	check(cfg.db.connectTimeout > 0, "db-connect-timeout: must be greater than 0")
+
+	check(cfg.archive.after >= 0, "archive-after: must not be negative")
+	check(cfg.archive.interval > 0, "archive-interval: must be greater than 0")
+	check(cfg.shutdownTimeout > 0, "shutdown-timeout: must be greater than 0")
+
+	check(cfg.log.format == "text" || cfg.log.format == "json",
+		"log-format: must be text or json (got %q)", cfg.log.format)
+	check(cfg.authHeader != "", "auth-header: must be provided")
+
+	u, err := url.Parse(cfg.baseURL)
+	check(err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+		u.Host != "", "base-url: must be an http(s) URL (got %q)", cfg.baseURL)
+
+	check(cfg.smtp.interval >= 0, "smtp-interval: must not be negative")
+
+	if cfg.smtp.interval > 0 {
+		check(cfg.smtp.host != "", "smtp-host: must be provided")
+		check(cfg.smtp.port > 0 && cfg.smtp.port < 65536,
+			"smtp-port: must be between 1 and 65535")
+		check(strings.Contains(cfg.smtp.sender, "@"),
+			"smtp-sender: must hold an email address (got %q)", cfg.smtp.sender)
+		check(cfg.smtp.maxAttempts > 0, "smtp-max-attempts: must be greater than 0")
+		check(cfg.smtp.overdueInterval > 0,
+			"smtp-overdue-interval: must be greater than 0")
+	}
+
+	check(cfg.webhook.interval >= 0, "webhook-interval: must not be negative")
+
+	if cfg.webhook.interval > 0 {
+		check(cfg.webhook.timeout > 0, "webhook-timeout: must be greater than 0")
+		check(cfg.webhook.maxAttempts > 0,
+			"webhook-max-attempts: must be greater than 0")
+	}
+
+	switch cfg.gmao.connector {
+	case "none", "fake":
+	case "http":
+		u, err := url.Parse(cfg.gmao.url)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+			u.Host != "", "gmao-url: must be an http(s) URL (got %q)",
+			cfg.gmao.url)
+		check(cfg.gmao.timeout > 0, "gmao-timeout: must be greater than 0")
+	case "file":
+		for _, dir := range []struct{ flag, path string }{
+			{"gmao-out-dir", cfg.gmao.outDir},
+			{"gmao-in-dir", cfg.gmao.inDir},
+		} {
+			info, err := os.Stat(dir.path)
+			check(err == nil && info.IsDir(), "%s: must be a directory (got %q)",
+				dir.flag, dir.path)
+		}
+	default:
+		check(false, "gmao-connector: must be none, http, file or fake (got %q)",
+			cfg.gmao.connector)
+	}
+
+	if cfg.gmao.connector != "none" {
+		check(cfg.gmao.interval > 0, "gmao-interval: must be greater than 0")
+	}
+
+	check(cfg.digest.hour >= 0 && cfg.digest.hour < 24,
+		"digest-hour: must be between 0 and 23")
+	check(cfg.digest.size > 0, "digest-size: must be greater than 0")
+
+	weekday, ok := parseWeekday(cfg.digest.day)
+	check(ok, "digest-weekday: must be a day like monday (got %q)",
+		cfg.digest.day)
+	cfg.digest.weekday = weekday
+
+	if cfg.uiDir != "" {
+		_, err := os.Stat(filepath.Join(cfg.uiDir, "html", "base.tmpl.html"))
+		check(err == nil, "ui-dir: %s doesn't contain html/base.tmpl.html",
+			cfg.uiDir)
+		check(!cfg.isProduction(), "ui-dir: can't be used in production")
+	}
+
+	return errors.Join(errs...)
+}
+
+// isDevelopment() is true when the errors must be detailed in the responses.
+// The templates are reloaded at each request with -ui-dir, whatever the env.
+func (cfg config) isDevelopment() bool {
+	return cfg.env == "development"
+}
+
+// isProduction() is true when the app is served over HTTPS only, so the
+// browser is told to never use plain HTTP (HSTS).
+func (cfg config) isProduction() bool {
+	return cfg.env == "production"
+}
+
+// parseWeekday() reads an english day name, case insensitive.
+func parseWeekday(s string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) {
+			return d, true
+		}
+	}
+
+	return time.Sunday, false
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"e-curatif/internal/data"
+)
+
+// Custom type so the key can't collide with the ones of other packages.
+type contextKey string
+
+const userContextKey = contextKey("user")
+
+// contextSetUser() returns a copy of the request with the user added to its
+// context.
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser() returns the user of the request, nil if anonymous.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, _ := r.Context().Value(userContextKey).(*data.User)
+	return user
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/mail"
+	"time"
+
+	"e-curatif/internal/data"
+	"e-curatif/internal/mailer"
+)
+
+// Time between two checks of the digests due.
+const digestCheck = 5 * time.Minute
+
+// digest is passed to the digest.tmpl template of the mailer.
+type digest struct {
+	User    *data.User
+	Period  string // "quotidien" or "hebdomadaire"
+	From    time.Time
+	To      time.Time
+	Sources []*data.Digest
+
+	// Links start with BaseURL.
+	BaseURL        string
+	PreferencesURL string
+}
+
+// digestJob() queues the digests due every digestCheck until ctx is done.
+// A digest missed while the app was stopped is sent at the next start.
+func (app *application) digestJob(ctx context.Context) {
+	if !app.emailsEnabled() {
+		return
+	}
+
+	ticker := time.NewTicker(digestCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.queueDigests(ctx, time.Now())
+		}
+	}
+}
+
+// digestDue() returns when the last digest of period was due at now, and the
+// start of the period it covers. A period ends when its digest is due.
+func (app *application) digestDue(period string, now time.Time) (due, from time.Time) {
+	now = now.Local()
+
+	due = time.Date(now.Year(), now.Month(), now.Day(), app.config.digest.hour,
+		0, 0, 0, time.Local)
+	if due.After(now) {
+		due = due.AddDate(0, 0, -1)
+	}
+
+	if period == data.DigestDaily {
+		return due, due.AddDate(0, 0, -1)
+	}
+
+	for due.Weekday() != app.config.digest.weekday {
+		due = due.AddDate(0, 0, -1)
+	}
+
+	return due, due.AddDate(0, 0, -7)
+}
+
+// queueDigests() is a single run of digestJob(): every user whose digest is
+// due gets one in the outbox. Sources without activity are left out, and
+// nothing is sent if they all are.
+func (app *application) queueDigests(ctx context.Context, now time.Time) {
+	periods := map[string]string{
+		data.DigestDaily:  "quotidien",
+		data.DigestWeekly: "hebdomadaire",
+	}
+
+	for _, period := range []string{data.DigestDaily, data.DigestWeekly} {
+		due, from := app.digestDue(period, now)
+
+		users, err := app.users.DigestDue(ctx, period, due)
+		if err != nil {
+			app.logger.Error("could not read the digest users", "period",
+				period, "error", err)
+			continue
+		}
+
+		if len(users) == 0 {
+			continue
+		}
+
+		digests, err := app.sources.Digest(ctx, from, due,
+			app.config.digest.size)
+		if err != nil {
+			app.logger.Error("could not read the digests", "period", period,
+				"error", err)
+			continue
+		}
+
+		sources := []*data.Digest{}
+
+		for _, d := range digests {
+			if !d.Empty() {
+				sources = append(sources, d)
+			}
+		}
+
+		for _, u := range users {
+			if len(sources) > 0 {
+				err = app.queueDigest(ctx, period, &digest{
+					User:           u,
+					Period:         periods[period],
+					From:           from,
+					To:             due,
+					Sources:        sources,
+					BaseURL:        app.config.baseURL,
+					PreferencesURL: app.config.baseURL + "/account/notifications",
+				})
+				if err != nil {
+					app.logger.Error("could not queue the digest", "user_id",
+						u.ID, "period", period, "error", err)
+					continue
+				}
+			}
+
+			err = app.users.SetDigestSent(ctx, u.ID, now)
+			if err != nil {
+				app.logger.Error("could not update the digest user", "user_id",
+					u.ID, "error", err)
+			}
+		}
+
+		app.logger.Info("digests queued", "period", period, "users", len(users),
+			"sources", len(sources))
+	}
+}
+
+func (app *application) queueDigest(ctx context.Context, period string,
+	d *digest) error {
+
+	msg, err := mailer.Render("digest.tmpl", d)
+	if err != nil {
+		return err
+	}
+
+	_, err = app.outbox.Insert(ctx, &data.Email{
+		Recipient: (&mail.Address{Name: d.User.Name, Address: d.User.Email}).String(),
+		Subject:   msg.Subject,
+		Text:      msg.Text,
+		HTML:      msg.HTML,
+		Kind:      "digest_" + period,
+	})
+
+	return err
+}
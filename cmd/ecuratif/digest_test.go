@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"e-curatif/internal/data"
+)
+
+// The weekly digest is due on -digest-weekday, read by loadConfig().
+func TestDigestDue(t *testing.T) {
+	cfg, _, err := loadConfig([]string{"-db-dsn", "postgres://localhost/test",
+		"-digest-weekday", "friday",
+		"-digest-hour", "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{config: cfg}
+
+	day := func(d, hour int) time.Time {
+		// 2024-05-17 is a Friday.
+		return time.Date(2024, time.May, d, hour, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name     string
+		period   string
+		now      time.Time
+		wantDue  time.Time
+		wantFrom time.Time
+	}{
+		{"daily after the hour", data.DigestDaily, day(15, 9), day(15, 7),
+			day(14, 7)},
+		{"daily before the hour", data.DigestDaily, day(15, 6), day(14, 7),
+			day(13, 7)},
+		{"weekly on the day", data.DigestWeekly, day(17, 8), day(17, 7),
+			day(10, 7)},
+		{"weekly before the hour", data.DigestWeekly, day(17, 6), day(10, 7),
+			day(3, 7)},
+		{"weekly in the week", data.DigestWeekly, day(21, 12), day(17, 7),
+			day(10, 7)},
+	}
+
+	for _, tt := range tests {
+		due, from := app.digestDue(tt.period, tt.now)
+
+		if !due.Equal(tt.wantDue) || !from.Equal(tt.wantFrom) {
+			t.Errorf("%s: got %s - %s, want %s - %s", tt.name, from, due,
+				tt.wantFrom, tt.wantDue)
+		}
+	}
+
+	if got := app.config.digest.weekday; got != time.Friday {
+		t.Errorf("got weekday %s, want Friday", got)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// ###########
+// Error pages
+// ###########
+
+// errorData is displayed by the error.tmpl.html page.
+type errorData struct {
+	Status  int
+	Title   string
+	Message string
+
+	// Error and trace, only set in development.
+	Detail string
+}
+
+// Title and message of the error pages. The other statuses use the standard
+// status text.
+var errorMessages = map[int][2]string{
+	http.StatusBadRequest: {"Requête invalide",
+		"La requête envoyée n'est pas valide."},
+	http.StatusUnauthorized: {"Authentification requise",
+		"Cette page n'est accessible qu'aux utilisateurs identifiés."},
+	http.StatusForbidden: {"Action interdite",
+		"Seul le propriétaire peut modifier cet élément."},
+	http.StatusNotFound: {"Page introuvable",
+		"La page demandée n'existe pas ou a été supprimée."},
+	http.StatusMethodNotAllowed: {"Méthode non autorisée",
+		"Cette action n'est pas possible sur cette page."},
+	http.StatusConflict: {"Action impossible",
+		"L'action est en conflit avec l'état actuel des données. Une source doit être vide pour être supprimée."},
+	http.StatusUnprocessableEntity: {"Données invalides",
+		"Les données envoyées n'ont pas pu être traitées. Vérifiez le fichier ou le formulaire puis réessayez."},
+	http.StatusInternalServerError: {"Erreur interne",
+		"Une erreur est survenue de notre côté. Réessayez plus tard, et si le problème persiste contactez l'administrateur."},
+	http.StatusServiceUnavailable: {"Service indisponible",
+		"La base de données est momentanément inaccessible. Réessayez dans quelques instants."},
+}
+
+// errorPage() sends the error page of the status, or a JSON error to the API
+// clients. detail is only displayed in development.
+func (app *application) errorPage(w http.ResponseWriter, r *http.Request,
+	status int, detail string) {
+
+	if wantsJSON(r) {
+		app.errorResponse(w, r, status, strings.ToLower(http.StatusText(status)))
+		return
+	}
+
+	e := &errorData{
+		Status:  status,
+		Title:   http.StatusText(status),
+		Message: http.StatusText(status),
+		Detail:  detail,
+	}
+
+	if m, ok := errorMessages[status]; ok {
+		e.Title, e.Message = m[0], m[1]
+	}
+
+	// render() can't be used: a failing error page would call serverError()
+	// again. The plain status text is sent instead.
+	cache, err := app.templates()
+	if err == nil {
+		if ts, ok := cache["error.tmpl.html"]; ok {
+			data := app.newTemplateData(r)
+			data.Error = e
+
+			buf := new(bytes.Buffer)
+
+			err = ts.ExecuteTemplate(buf, "base", data)
+			if err == nil {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(status)
+				buf.WriteTo(w)
+				return
+			}
+		}
+	}
+
+	if err != nil {
+		app.requestLogger(r).Error("could not render error page", "error", err)
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
+
+// notFoundHandler and methodNotAllowedHandler replace the chi default
+// responses, so unknown routes get the error pages too.
+func (app *application) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	app.notFound(w, r)
+}
+
+func (app *application) methodNotAllowedHandler(w http.ResponseWriter,
+	r *http.Request) {
+
+	app.clientError(w, r, http.StatusMethodNotAllowed)
+}
+
+// wantsJSON() is true for the API routes, and for clients asking for JSON
+// rather than HTML.
+func wantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+
+	accept := r.Header.Get("Accept")
+
+	return strings.Contains(accept, "application/json") &&
+		!strings.Contains(accept, "text/html")
+}
+
+// ##########
+// API errors
+// ##########
+
+// apiError is the format of every error sent by the API:
+//
+//	{"error": {"status": 422, "message": "failed validation",
+//	  "fields": {"agent": "must not be empty"}, "request_id": "..."}}
+type apiError struct {
+	Status    int               `json:"status"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+func newAPIError(r *http.Request, status int, message string) *apiError {
+	return &apiError{
+		Status:    status,
+		Message:   message,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// errorResponse() sends a JSON error message to an API client.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request,
+	status int, message string) {
+
+	app.sendAPIError(w, r, newAPIError(r, status, message))
+}
+
+// failedValidationResponse() sends a 422 with the error of each field.
+func (app *application) failedValidationResponse(w http.ResponseWriter,
+	r *http.Request, fields map[string]string) {
+
+	e := newAPIError(r, http.StatusUnprocessableEntity, "failed validation")
+	e.Fields = fields
+
+	app.sendAPIError(w, r, e)
+}
+
+func (app *application) sendAPIError(w http.ResponseWriter, r *http.Request,
+	e *apiError) {
+
+	err := app.writeJSON(w, e.Status, envelope{"error": e}, nil)
+	if err != nil {
+		app.requestLogger(r).Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
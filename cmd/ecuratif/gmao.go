@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"e-curatif/internal/data"
+	"e-curatif/internal/gmao"
+)
+
+// Number of infos pushed, or work orders pulled, per call to the GMAO.
+const gmaoBatchSize = 100
+
+// newConnector() returns the GMAO connector of the config, nil for "none".
+func newConnector(cfg config) (gmao.Connector, error) {
+	switch cfg.gmao.connector {
+	case "none":
+		return nil, nil
+	case "http":
+		return gmao.NewHTTP(cfg.gmao.url, cfg.gmao.token, cfg.gmao.timeout), nil
+	case "file":
+		return gmao.NewFileDrop(cfg.gmao.outDir, cfg.gmao.inDir), nil
+	case "fake":
+		return gmao.NewFake(), nil
+	}
+
+	return nil, fmt.Errorf("unknown GMAO connector %q", cfg.gmao.connector)
+}
+
+// gmaoJob() synchronizes the infos with the GMAO every gmao.interval until
+// ctx is done.
+func (app *application) gmaoJob(ctx context.Context) {
+	if app.gmao == nil {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.gmao.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.pushWorkRequests(ctx)
+			app.pullWorkOrders(ctx)
+		}
+	}
+}
+
+// pushWorkRequests() sends the open infos of the sources having a code_GMAO
+// to the GMAO, and records the ID of their work order. A failed info is
+// tried again at the next run.
+func (app *application) pushWorkRequests(ctx context.Context) {
+	items, err := app.infos.Unpushed(ctx, gmaoBatchSize)
+	if err != nil {
+		app.logger.Error("could not read the infos to push", "error", err)
+		return
+	}
+
+	for _, item := range items {
+		i := item.Info
+
+		id, err := app.gmao.Push(ctx, &gmao.WorkRequest{
+			Reference: gmao.Reference(i.ID),
+			Site:      item.CodeGMAO,
+			Material:  i.Material,
+			Event:     i.Event,
+			Detail:    i.Detail,
+			Priority:  i.Priority,
+			Agent:     i.Agent,
+			Target:    i.Target,
+			Created:   i.Created,
+		})
+		if err != nil {
+			app.metrics.gmao.Inc("push_failed")
+			app.logger.Warn("could not push the info to the GMAO", "info_id",
+				i.ID, "error", err)
+			continue
+		}
+
+		err = app.infos.SetWorkOrder(ctx, i.ID, id)
+		if err != nil {
+			app.logger.Error("could not record the work order", "info_id",
+				i.ID, "work_order", id, "error", err)
+			continue
+		}
+
+		app.metrics.gmao.Inc("pushed")
+		app.logger.Info("info pushed to the GMAO", "info_id", i.ID,
+			"work_order", id)
+	}
+}
+
+// pullWorkOrders() reads the state of the work orders of the open infos, and
+// updates the infos whose status changed in the GMAO. An info edited in the
+// meantime is updated at the next run.
+func (app *application) pullWorkOrders(ctx context.Context) {
+	infos, err := app.infos.Pushed(ctx)
+	if err != nil {
+		app.logger.Error("could not read the pushed infos", "error", err)
+		return
+	}
+
+	for start := 0; start < len(infos); start += gmaoBatchSize {
+		batch := infos[start:min(start+gmaoBatchSize, len(infos))]
+
+		byOrder := map[string]*data.Info{}
+		ids := []string{}
+
+		for _, i := range batch {
+			byOrder[i.WorkOrder] = i
+			ids = append(ids, i.WorkOrder)
+		}
+
+		orders, err := app.gmao.Pull(ctx, ids)
+		if err != nil {
+			app.metrics.gmao.Inc("pull_failed")
+			app.logger.Warn("could not pull the work orders", "error", err)
+			return
+		}
+
+		for _, o := range orders {
+			i, ok := byOrder[o.ID]
+			if !ok || (o.Status == i.Status &&
+				(o.DoneBy == "" || o.DoneBy == i.Doneby)) {
+				continue
+			}
+
+			app.applyWorkOrder(ctx, i.ID, o)
+		}
+	}
+}
+
+// applyWorkOrder() sets the status of the work order, and who did it, on
+// the info id.
+func (app *application) applyWorkOrder(ctx context.Context, id int,
+	o *gmao.WorkOrder) {
+
+	logger := app.logger.With("info_id", id, "work_order", o.ID)
+
+	before, err := app.infos.Data(ctx, id)
+	if err != nil {
+		if !errors.Is(err, data.ErrNoRows) {
+			logger.Error("could not read the info", "error", err)
+		}
+
+		return
+	}
+
+	after := *before
+	after.Status = o.Status
+
+	if o.DoneBy != "" {
+		after.Doneby = o.DoneBy
+	}
+
+	err = app.infos.Update(ctx, &after)
+	if err != nil {
+		if !errors.Is(err, data.ErrEditConflict) {
+			logger.Error("could not update the info", "error", err)
+		}
+
+		return
+	}
+
+	app.metrics.gmao.Inc("updated")
+	logger.Info("info updated from the GMAO", "status", after.Status)
+
+	app.notifyInfo(ctx, logger, before, &after)
+	app.infoEvents(ctx, logger, before, &after)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"e-curatif/internal/data"
+	"e-curatif/internal/gmao"
+)
+
+// The infos of the sources having a code_GMAO are pushed once, then their
+// status and doneby follow the work order.
+func TestGMAOSync(t *testing.T) {
+	app, models := newTestApplication(t)
+	ctx := context.Background()
+
+	fake := gmao.NewFake()
+	app.gmao = fake
+
+	lyon, err := models.Sources.Insert(ctx, &data.Source{Name: "Lyon",
+		CodeGMAO: "LYO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without code, the infos aren't pushed.
+	vienne, err := models.Sources.Insert(ctx, &data.Source{Name: "Vienne"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newInfo := func(source int, status string) int {
+		id, err := models.Infos.Insert(ctx, &data.Info{SourceID: source,
+			Agent: "dupont", Material: "TR 1", Detail: "fuite",
+			Event: "ronde", Priority: 2, Status: status})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return id
+	}
+
+	pushed := newInfo(lyon, "en attente")
+	newInfo(lyon, "archivé")
+	newInfo(vienne, "en attente")
+
+	app.pushWorkRequests(ctx)
+
+	if len(fake.Requests) != 1 {
+		t.Fatalf("got %d work requests, want 1", len(fake.Requests))
+	}
+
+	wr := fake.Requests[0]
+	if wr.Reference != gmao.Reference(pushed) || wr.Site != "LYO" ||
+		wr.Material != "TR 1" || wr.Priority != 2 {
+		t.Errorf("got work request %+v", wr)
+	}
+
+	i, err := models.Infos.Data(ctx, pushed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i.WorkOrder != "FAKE-1" {
+		t.Fatalf("got work order %q, want FAKE-1", i.WorkOrder)
+	}
+
+	// Already pushed.
+	app.pushWorkRequests(ctx)
+
+	if len(fake.Requests) != 1 {
+		t.Errorf("got %d work requests after another run, want 1",
+			len(fake.Requests))
+	}
+
+	tests := []struct {
+		name        string
+		status      string // in the GMAO
+		doneBy      string
+		wantStatus  string
+		wantVersion int
+	}{
+		{"unchanged", "open", "", "en attente", 1},
+		{"assigned", "assigned", "", "affecté", 2},
+		{"assigned again", "in_progress", "", "affecté", 2},
+		{"done", "done", "entreprise Martin", "résolu", 3},
+	}
+
+	for _, tt := range tests {
+		if err := fake.SetStatus("FAKE-1", tt.status, tt.doneBy); err != nil {
+			t.Fatal(err)
+		}
+
+		app.pullWorkOrders(ctx)
+
+		// A résolu info isn't returned by Data(), the search finds it.
+		results, err := models.Infos.Search(ctx, data.SearchFilters{
+			Status: tt.wantStatus})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, r := range results {
+			found = found || r.ID == pushed
+		}
+
+		if !found {
+			t.Errorf("%s: info not %q", tt.name, tt.wantStatus)
+			continue
+		}
+
+		if tt.wantStatus == "résolu" {
+			continue
+		}
+
+		i, err := models.Infos.Data(ctx, pushed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i.Version != tt.wantVersion {
+			t.Errorf("%s: got version %d, want %d", tt.name, i.Version,
+				tt.wantVersion)
+		}
+	}
+
+	// Who did it comes from the work order.
+	results, err := models.Infos.Search(ctx, data.SearchFilters{
+		Query: "Martin", Status: "résolu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].ID != pushed {
+		t.Errorf("doneby: got %d results, want info %d", len(results), pushed)
+	}
+
+	// A résolu info isn't pulled anymore.
+	infos, err := models.Infos.Pushed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 0 {
+		t.Errorf("got %d infos still pulled, want 0", len(infos))
+	}
+}
+
+// newConnector() follows -gmao-connector.
+func TestNewConnector(t *testing.T) {
+	tests := []struct {
+		connector string
+		want      string
+		wantErr   bool
+	}{
+		{"none", "<nil>", false},
+		{"fake", "*gmao.Fake", false},
+		{"http", "*gmao.HTTP", false},
+		{"file", "*gmao.FileDrop", false},
+		{"sap", "<nil>", true},
+	}
+
+	for _, tt := range tests {
+		var cfg config
+		cfg.gmao.connector = tt.connector
+
+		c, err := newConnector(cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v", tt.connector, err)
+		}
+
+		if got := fmt.Sprintf("%T", c); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.connector, got, tt.want)
+		}
+	}
+}
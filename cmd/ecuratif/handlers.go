@@ -6,41 +6,29 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"e-curatif/internal/data"
 	"e-curatif/internal/validator"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// Calls openDB function via application struct, acquires a communication with
-// PSQL. If it can't have a connection with the DB then log an error.
-// TODO: Add web error page with a 500 status code
-func (app *application) dbConn(ctx context.Context) *pgxpool.Conn {
-	conn, err := app.DB.Acquire(ctx)
-	if err != nil {
-		app.errorLog.Fatalln("Couldn't connect to DB")
-		return nil
-	}
-
-	return conn
-}
-
 // #########
 // Home page
 // #########
 
 // Retrieve a slice of all active Info related to their Source
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
-	s, err := app.source.GetAllActive(conn)
+	s, err := app.sources.GetAllActive(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -49,8 +37,29 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Sources = s
 
+	// Pinned views of the user and its team, with their counts.
+	if user := app.contextGetUser(r); user != nil {
+		views, err := app.views.ForUser(r.Context(), user)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		for _, v := range views {
+			if v.Pinned {
+				data.Views = append(data.Views, v)
+			}
+		}
+
+		err = app.countViews(r.Context(), data.Views)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
 	// Pass the data to the render() helper so it can be displayed
-	app.render(w, http.StatusOK, "home.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "home.tmpl.html", data)
 }
 
 // ###############
@@ -61,51 +70,351 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 // It capitalizad so it can be exported and be read by html/template package
 // when rendering the template.
 type sourceCreateForm struct {
-	Name string
+	Name         string
+	ArchiveAfter string
+	CodeGMAO     string
+	Voltage      string
+	Address      string
+	Latitude     string
+	Longitude    string
+	Team         string
+	Notes        string
 
 	validator.Validator
 }
 
+// GMAO codes are stored upper-case: a letter or a digit followed by 1 to 19
+// letters, digits, "-" or "_".
+// Exemple: PS-LYON_01
+var codeGMAORX = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{1,19}$`)
+
+// normalizeCodeGMAO() trims and upper-cases a GMAO code before its check.
+func normalizeCodeGMAO(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// validCoordinates() is true if both coordinates are missing, or both are set
+// and within the range of a latitude and a longitude.
+func validCoordinates(lat, lng *float64) bool {
+	if lat == nil || lng == nil {
+		return lat == nil && lng == nil
+	}
+
+	return *lat >= -90 && *lat <= 90 && *lng >= -180 && *lng <= 180
+}
+
+// parseCoordinate() reads a latitude or a longitude typed in a form, "45,76"
+// is read like "45.76". An empty value is nil, ok is false if it isn't a
+// number.
+func parseCoordinate(value string) (coord *float64, ok bool) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), ",", ".")
+	if value == "" {
+		return nil, true
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return &f, true
+}
+
+// readSourceForm() reads and checks the form of sourceCreate and
+// sourceUpdate. The source is only complete when the form is valid.
+func readSourceForm(r *http.Request) (sourceCreateForm, *data.Source) {
+	form := sourceCreateForm{
+		Name:         r.PostForm.Get("name"),
+		ArchiveAfter: r.PostForm.Get("archive_after"),
+		CodeGMAO:     normalizeCodeGMAO(r.PostForm.Get("code_gmao")),
+		Voltage:      strings.TrimSpace(r.PostForm.Get("voltage")),
+		Address:      strings.TrimSpace(r.PostForm.Get("address")),
+		Latitude:     strings.TrimSpace(r.PostForm.Get("latitude")),
+		Longitude:    strings.TrimSpace(r.PostForm.Get("longitude")),
+		Team:         strings.TrimSpace(r.PostForm.Get("team")),
+		Notes:        strings.TrimSpace(r.PostForm.Get("notes")),
+	}
+
+	emptyField := "Ce champ ne doit pas être vide"
+
+	form.CheckField(validator.NotBlank(form.Name), "name", emptyField)
+
+	if validator.NotBlank(form.ArchiveAfter) {
+		form.CheckField(validator.IsNumber(form.ArchiveAfter),
+			"archive_after", "Ce champ doit être un nombre de jours")
+	}
+
+	if form.CodeGMAO != "" {
+		form.CheckField(validator.Matches(form.CodeGMAO, codeGMAORX),
+			"code_gmao", "Lettres, chiffres, - ou _ (2 à 20 caractères)")
+	}
+
+	if form.Voltage != "" {
+		form.CheckField(validator.IsNumber(form.Voltage) && form.Voltage != "0",
+			"voltage", "Ce champ doit être un nombre de kV")
+	}
+
+	lat, latOK := parseCoordinate(form.Latitude)
+	lng, lngOK := parseCoordinate(form.Longitude)
+
+	form.CheckField(latOK, "latitude", "Ce champ doit être un nombre")
+	form.CheckField(lngOK, "longitude", "Ce champ doit être un nombre")
+
+	if latOK && lngOK {
+		form.CheckField(validCoordinates(lat, lng), "latitude",
+			"Latitude (-90 à 90) et longitude (-180 à 180) vont ensemble")
+	}
+
+	src := &data.Source{
+		Name:      form.Name,
+		CodeGMAO:  form.CodeGMAO,
+		Address:   form.Address,
+		Latitude:  lat,
+		Longitude: lng,
+		Team:      form.Team,
+		Notes:     form.Notes,
+	}
+
+	// Blank is the global value, 0 never archives.
+	if days, err := strconv.Atoi(strings.TrimSpace(form.ArchiveAfter)); err == nil {
+		src.ArchiveAfter = &days
+	}
+
+	src.VoltageKV, _ = strconv.Atoi(form.Voltage)
+
+	return form, src
+}
+
+// sourceFormError() turns the unique violations of the source table into
+// errors of the form. ok is false for any other error.
+func sourceFormError(form *sourceCreateForm, err error) (ok bool) {
+	switch {
+	case errors.Is(err, data.ErrDuplicate):
+		form.AddFieldError("name", "Une source porte déjà ce nom")
+	case errors.Is(err, data.ErrDuplicateCode):
+		form.AddFieldError("code_gmao", "Ce code GMAO est déjà utilisé")
+	default:
+		return false
+	}
+
+	return true
+}
+
+// newSourceForm() fills the form of sourceUpdate with the source.
+func newSourceForm(src *data.Source) sourceCreateForm {
+	form := sourceCreateForm{
+		Name:     src.Name,
+		CodeGMAO: src.CodeGMAO,
+		Address:  src.Address,
+		Team:     src.Team,
+		Notes:    src.Notes,
+	}
+
+	if src.ArchiveAfter != nil {
+		form.ArchiveAfter = strconv.Itoa(*src.ArchiveAfter)
+	}
+
+	if src.VoltageKV > 0 {
+		form.Voltage = strconv.Itoa(src.VoltageKV)
+	}
+
+	if src.Latitude != nil && src.Longitude != nil {
+		form.Latitude = strconv.FormatFloat(*src.Latitude, 'f', -1, 64)
+		form.Longitude = strconv.FormatFloat(*src.Longitude, 'f', -1, 64)
+	}
+
+	return form
+}
+
 // sourceView() handler checks in the URL string the parameter "id", converts it
 // to a integer and check if exists. If yes then fetch the data to be displayed.
 func (app *application) sourceView(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
 	key := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(key)
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
-	src, err := app.source.Data(id, conn)
+	src, err := app.sources.Data(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrNoRows) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 
 		return
 	}
 
-	infos, err := app.info.List(id, conn)
-	if err != nil {
-		if errors.Is(err, data.ErrNoRows) {
-			app.notFound(w)
-		} else {
-			app.serverError(w, err)
-		}
+	form, filters := readSourceFilters(r.URL.Query())
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Source = src
+		data.Form = form
+
+		app.render(w, r, http.StatusUnprocessableEntity,
+			"sourceView.tmpl.html", data)
+		return
+	}
 
+	infos, metadata, err := app.infos.List(r.Context(), id, filters)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
 	data := app.newTemplateData(r)
 	data.Source = src
 	data.Infos = infos
+	data.Metadata = metadata
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "sourceView.tmpl.html", data)
+}
+
+// sourceFilterForm holds the filters of the sourceView page. They live in the
+// query string so a view can be bookmarked or shared.
+// Exemple: /source/view/3?status=affecté&agent=dupont&sort=-created&page=2
+type sourceFilterForm struct {
+	Status   string
+	Priority string
+	Agent    string
+	Overdue  string
+	From     string
+	To       string
+	Sort     string
+	Page     string
+
+	validator.Validator
+}
+
+// readSourceFilters() reads the filters from the query string.
+func readSourceFilters(qs url.Values) (sourceFilterForm, data.InfoFilters) {
+	form := sourceFilterForm{
+		Status:   qs.Get("status"),
+		Priority: qs.Get("priority"),
+		Agent:    strings.TrimSpace(qs.Get("agent")),
+		Overdue:  qs.Get("overdue"),
+		From:     qs.Get("from"),
+		To:       qs.Get("to"),
+		Sort:     qs.Get("sort"),
+		Page:     qs.Get("page"),
+	}
+
+	f := data.InfoFilters{
+		Status:  form.Status,
+		Agent:   form.Agent,
+		Overdue: form.Overdue != "",
+		Sort:    form.Sort,
+	}
+
+	if form.Status != "" {
+		form.CheckField(validator.PermittedValue(form.Status, searchStatuses...),
+			"status", "Statut inconnu")
+	}
+
+	if form.Priority != "" {
+		form.CheckField(validator.IsNumber(form.Priority), "priority",
+			"La priorité doit être un nombre")
+		f.Priority, _ = strconv.Atoi(form.Priority)
+	}
+
+	if form.Sort != "" {
+		form.CheckField(validator.PermittedValue(form.Sort, data.SortSafelist...),
+			"sort", "Tri inconnu")
+	}
+
+	if form.Page != "" {
+		form.CheckField(validator.IsNumber(form.Page), "page",
+			"La page doit être un nombre")
+		f.Page, _ = strconv.Atoi(strings.TrimSpace(form.Page))
+
+		// The pages start at 1, 0 would give a negative offset.
+		form.CheckField(f.Page >= 1, "page", "La première page est 1")
+	}
+
+	var err error
+
+	if form.From != "" {
+		f.CreatedFrom, err = time.Parse(data.DateLayout, form.From)
+		form.CheckField(err == nil, "from", "Date invalide")
+	}
+
+	// The "to" day is included.
+	if form.To != "" {
+		f.CreatedTo, err = time.Parse(data.DateLayout, form.To)
+		form.CheckField(err == nil, "to", "Date invalide")
+		f.CreatedTo = f.CreatedTo.AddDate(0, 0, 1)
+	}
+
+	return form, f
+}
+
+// values() returns the filters set, to build the links of the page.
+func (f sourceFilterForm) values() url.Values {
+	qs := url.Values{}
+
+	fields := []struct{ key, value string }{
+		{"status", f.Status}, {"priority", f.Priority}, {"agent", f.Agent},
+		{"overdue", f.Overdue}, {"from", f.From}, {"to", f.To},
+		{"sort", f.Sort}, {"page", f.Page},
+	}
+
+	for _, field := range fields {
+		if field.value != "" {
+			qs.Set(field.key, field.value)
+		}
+	}
+
+	return qs
+}
+
+// SortURL() returns the link of a column header: sorts by column, or
+// reverses the order if the list is already sorted by column. The list goes
+// back to the first page.
+func (f sourceFilterForm) SortURL(column string) string {
+	qs := f.values()
+	qs.Del("page")
+
+	current := f.Sort
+	if current == "" {
+		current = data.DefaultSort
+	}
+
+	if current == column {
+		qs.Set("sort", "-"+column)
+	} else {
+		qs.Set("sort", column)
+	}
+
+	return "?" + qs.Encode()
+}
+
+// SortIndicator() returns the arrow displayed next to the sorted column.
+func (f sourceFilterForm) SortIndicator(column string) string {
+	current := f.Sort
+	if current == "" {
+		current = data.DefaultSort
+	}
+
+	switch current {
+	case column:
+		return "▲"
+	case "-" + column:
+		return "▼"
+	}
+
+	return ""
+}
+
+// PageURL() returns the link to another page with the same filters.
+func (f sourceFilterForm) PageURL(page int) string {
+	qs := f.values()
+	qs.Set("page", strconv.Itoa(page))
 
-	app.render(w, http.StatusOK, "sourceView.tmpl.html", data)
+	return "?" + qs.Encode()
 }
 
 // Generate the sourceCreate page to the user, once field filled and submitted,
@@ -116,40 +425,38 @@ func (app *application) sourceCreate(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = sourceCreateForm{}
 
-	app.render(w, http.StatusOK, "sourceCreate.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "sourceCreate.tmpl.html", data)
 }
 
 func (app *application) sourceCreatePost(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
 	err := r.ParseForm()
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-	}
-
-	form := sourceCreateForm{
-		Name: r.PostForm.Get("name"),
+		app.clientError(w, r, http.StatusBadRequest)
+		return
 	}
 
-	emptyField := "Ce champ ne doit pas être vide"
+	form, src := readSourceForm(r)
 
-	form.CheckField(validator.NotBlank(form.Name),
-		"name", emptyField)
+	if form.Valid() {
+		_, err = app.sources.Insert(r.Context(), src)
+		if err != nil && !sourceFormError(&form, err) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity,
+		app.render(w, r, http.StatusUnprocessableEntity,
 			"sourceCreate.tmpl.html", data)
 		return
 	}
 
-	id, err := app.source.Insert(form.Name, conn)
-	if err != nil {
-		app.serverError(w, err)
-		return
-	}
+	id := src.ID
+
+	app.sourceEvent(r.Context(), app.requestLogger(r), data.EventSourceCreated,
+		src)
 
 	http.Redirect(w, r, fmt.Sprintf("/source/view/%d", id),
 		http.StatusSeeOther)
@@ -158,50 +465,49 @@ func (app *application) sourceCreatePost(w http.ResponseWriter, r *http.Request)
 // To delete a Source, only a POST form is necessary.
 // Same idea as sourceView, but deletes the source choosen.
 func (app *application) sourceDeletePost(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
 	key := chi.URLParam(r, "id")
 
 	id, err := strconv.Atoi(key)
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
-	err = app.source.Delete(id, conn)
+	err = app.sources.Delete(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrNoRows) {
-			app.notFound(w)
+			app.notFound(w, r)
+		} else if errors.Is(err, data.ErrSourceNotEmpty) {
+			app.clientError(w, r, http.StatusConflict)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 
 		return
 	}
 
+	app.fireWebhooks(r.Context(), app.requestLogger(r),
+		data.EventSourceDeleted, webhookSource{ID: id})
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 // To update a Source and to simplify the user, first we fetch the data from the
 // Source id, display it in the field before beeing modified.
 func (app *application) sourceUpdate(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
 	key := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(key)
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
-	src, err := app.source.Data(id, conn)
+	src, err := app.sources.Data(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrNoRows) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 
 		return
@@ -209,149 +515,195 @@ func (app *application) sourceUpdate(w http.ResponseWriter, r *http.Request) {
 
 	data := app.newTemplateData(r)
 	data.Source = src
+	data.Form = newSourceForm(src)
 
-	app.render(w, http.StatusOK, "sourceUpdate.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "sourceUpdate.tmpl.html", data)
 }
 
 func (app *application) sourceUpdatePost(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
 	err := r.ParseForm()
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
+		return
 	}
 
 	key := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(key)
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
-	form := sourceCreateForm{
-		Name: r.PostForm.Get("name"),
-	}
-
-	emptyField := "Ce champ ne doit pas être vide"
+	form, src := readSourceForm(r)
+	src.ID = id
 
-	form.CheckField(validator.NotBlank(form.Name), "name", emptyField)
+	if form.Valid() {
+		err = app.sources.Update(r.Context(), src)
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+			return
+		} else if err != nil && !sourceFormError(&form, err) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
 
-		app.render(w, http.StatusUnprocessableEntity,
+		app.render(w, r, http.StatusUnprocessableEntity,
 			"sourceUpdate.tmpl.html", data)
 		return
 	}
 
-	app.source.Name = form.Name
+	app.sourceEvent(r.Context(), app.requestLogger(r), data.EventSourceUpdated,
+		src)
+
+	http.Redirect(w, r, fmt.Sprintf("/source/view/%d", id),
+		http.StatusSeeOther)
+}
+
+// Manual bulk archive. Every info "résolu" of the source is archived right
+// away without waiting for the archiving delay.
+func (app *application) sourceArchivePost(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
 
-	err = app.source.Update(id, conn)
+	infos, err := app.infos.ArchiveSource(r.Context(), id)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
+	app.logArchived(app.requestLogger(r), "manual", infos)
+
 	http.Redirect(w, r, fmt.Sprintf("/source/view/%d", id),
 		http.StatusSeeOther)
 }
 
+// Runs the archiving policy for every source without waiting for the next
+// scheduled run.
+func (app *application) archivePost(w http.ResponseWriter, r *http.Request) {
+	infos, err := app.infos.ArchiveResolved(r.Context(), app.config.archive.after)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logArchived(app.requestLogger(r), "manual", infos)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
 // #############
 // Info handlers
 // #############
 
 // Same thing as sourceCreateForm struct.
 type infoCreateForm struct {
-	ID       int
-	Agent    string
-	Material string
-	Priority string
-	Target   string
-	Detail   string
-	Created  string
-	Updated  string
-	Status   string
-	Event    string
-	Rte      string
-	Estimate string
-	Brips    string
-	Ais      string
-	Oups     string
-	Ameps    string
-	Doneby   string
+	ID        int
+	Agent     string
+	Material  string
+	Equipment string
+	Priority  string
+	Target    string
+	Detail    string
+	Created   string
+	Updated   string
+	Status    string
+	Event     string
+	Rte       string
+	Estimate  string
+	Brips     string
+	Ais       string
+	Oups      string
+	Ameps     string
+	Doneby    string
+	Version   string
 
 	validator.Validator
 }
 
-func (app *application) infoCreate(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
+// newInfoForm() fills the form with the values of an existing info, so it can
+// be edited.
+func newInfoForm(i *data.Info) infoCreateForm {
+	return infoCreateForm{
+		ID:        i.ID,
+		Agent:     i.Agent,
+		Material:  i.Material,
+		Equipment: i.Equipment,
+		Priority:  strconv.Itoa(i.Priority),
+		Target:    i.TargetDate(),
+		Detail:    i.Detail,
+		Status:    i.Status,
+		Event:     i.Event,
+		Rte:       i.Rte,
+		Estimate:  i.Estimate,
+		Brips:     i.Brips,
+		Ais:       i.Ais,
+		Oups:      i.Oups,
+		Ameps:     i.Ameps,
+		Doneby:    i.Doneby,
+		Version:   strconv.Itoa(i.Version),
+	}
+}
 
-	key := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(key)
-	if err != nil || id < 1 {
-		app.notFound(w)
-		return
+// readEquipment() finds the equipment typed in the form in the catalogue of
+// the source, an unknown one is a field error. Without material, the info
+// takes the name of the equipment. id is 0 if there's no equipment.
+func (app *application) readEquipment(ctx context.Context,
+	form *infoCreateForm, sourceID int) (id int, err error) {
+
+	form.Equipment = strings.TrimSpace(form.Equipment)
+	if form.Equipment == "" {
+		return 0, nil
 	}
 
-	src, err := app.source.Data(id, conn)
+	e, err := app.equipment.ByName(ctx, sourceID, form.Equipment)
 	if err != nil {
 		if errors.Is(err, data.ErrNoRows) {
-			app.notFound(w)
-		} else {
-			app.serverError(w, err)
+			form.AddFieldError("equipment",
+				"Cet équipement n'est pas dans le catalogue de la source")
+			return 0, nil
 		}
 
-		return
+		return 0, err
 	}
 
-	data := app.newTemplateData(r)
-	data.Form = infoCreateForm{}
-	data.Source = src
+	form.Equipment = e.Name
+
+	if !validator.NotBlank(form.Material) {
+		form.Material = e.Name
+	}
 
-	app.render(w, http.StatusOK, "infoCreate.tmpl.html", data)
+	return e.ID, nil
 }
 
-// Starts connection with DB, read URL and fetch for the Source id.
-// Issue a request form with r.ParseForm function and retrieves every data in
-// the fields prompt by the user.
-// Some data are priority which are controled with "emptyField" helper, after
-// that send it DB.
-func (app *application) infoCreatePost(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
+// renderInfoForm() renders a page of infoForm with the catalogue of the
+// source for the autocompletion.
+func (app *application) renderInfoForm(w http.ResponseWriter, r *http.Request,
+	status int, page string, data *templateData, sourceID int) {
 
-	err := r.ParseForm()
+	catalogue, err := app.equipment.List(r.Context(), sourceID)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-	}
-
-	key := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(key)
-	if err != nil || id < 1 {
-		app.notFound(w)
+		app.serverError(w, r, err)
 		return
 	}
 
-	form := infoCreateForm{
-		Agent:    r.PostForm.Get("agent"),
-		Material: r.PostForm.Get("material"),
-		Detail:   r.PostForm.Get("detail"),
-		Event:    r.PostForm.Get("event"),
-		Priority: r.PostForm.Get("priority"),
-		Oups:     r.PostForm.Get("oups"),
-		Ameps:    r.PostForm.Get("ameps"),
-		Brips:    r.PostForm.Get("brips"),
-		Rte:      r.PostForm.Get("rte"),
-		Ais:      r.PostForm.Get("ais"),
-		Estimate: r.PostForm.Get("estimate"),
-		Target:   r.PostForm.Get("target"),
-		Status:   r.PostForm.Get("status"),
-		Doneby:   r.PostForm.Get("doneby"),
-	}
+	data.Catalogue = catalogue
+
+	app.render(w, r, status, page, data)
+}
 
+// check() checks the fields of the created or updated info, like the API
+// does: the required fields, the priority and the target date, which may be
+// empty.
+func (form *infoCreateForm) check() {
 	emptyField := "Ce champ ne doit pas être vide"
 
 	form.CheckField(validator.NotBlank(form.Agent),
@@ -369,131 +721,231 @@ func (app *application) infoCreatePost(w http.ResponseWriter, r *http.Request) {
 	form.CheckField(validator.NotBlank(form.Priority),
 		"priority", emptyField)
 
+	form.CheckField(form.priority() > 0,
+		"priority", "La priorité doit être un nombre supérieur à 0")
+
 	form.CheckField(validator.NotBlank(form.Status),
 		"status", emptyField)
 
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity,
-			"infoCreate.tmpl.html", data)
-		return
-	}
-
-	app.info.Agent = form.Agent
-	app.info.Material = form.Material
-	app.info.Detail = form.Detail
-	app.info.Event = form.Event
-	app.info.Oups = form.Oups
-	app.info.Ameps = form.Ameps
-	app.info.Brips = form.Brips
-	app.info.Rte = form.Rte
-	app.info.Ais = form.Ais
-	app.info.Estimate = form.Estimate
-	app.info.Target = form.Target
-	app.info.Status = form.Status
-	app.info.Doneby = form.Doneby
-	app.info.Priority, err = strconv.Atoi(form.Priority)
-	if err != nil {
-		app.notFound(w)
-		return
-	}
+	form.CheckField(form.Target == "" ||
+		validator.IsDate(form.Target, data.DateLayout),
+		"target", "La date doit être au format AAAA-MM-JJ")
+}
 
-	_, err = app.info.Insert(id, conn)
+// priority() returns the priority of the form, 0 if it isn't a number.
+func (form *infoCreateForm) priority() int {
+	n, err := strconv.Atoi(strings.TrimSpace(form.Priority))
 	if err != nil {
-		app.serverError(w, err)
-		return
+		return 0
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/source/%d/info/create", id),
-		http.StatusSeeOther)
+	return n
 }
 
-// Creates DB connection, read the URL and fetch "id", retrieves data from DB
-// with the specified "id".
-func (app *application) infoView(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
+func (app *application) infoCreate(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(key)
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
-	info, err := app.info.Data(id, conn)
+	src, err := app.sources.Data(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrNoRows) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 
 		return
 	}
 
 	data := app.newTemplateData(r)
-	data.Info = info
+	data.Form = infoCreateForm{}
+	data.Source = src
 
-	app.render(w, http.StatusOK, "infoView.tmpl.html", data)
+	app.renderInfoForm(w, r, http.StatusOK, "infoCreate.tmpl.html", data, id)
 }
 
-// Same thing as sourceDeletePost but for a info.
-func (app *application) infoDeletePost(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
-	sKey := chi.URLParam(r, "sid")
-	iKey := chi.URLParam(r, "id")
-
-	id, err := strconv.Atoi(iKey)
-	if err != nil || id < 1 {
-		app.notFound(w)
+// Starts connection with DB, read URL and fetch for the Source id.
+// Issue a request form with r.ParseForm function and retrieves every data in
+// the fields prompt by the user.
+// The fields are controled by check(), after that send it DB.
+func (app *application) infoCreatePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
-	sID, err := strconv.Atoi(sKey)
+	key := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(key)
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
-	err = app.info.Delete(id, conn)
-	if err != nil {
-		if errors.Is(err, data.ErrNoRows) {
-			app.notFound(w)
-		} else {
-			app.serverError(w, err)
-		}
+	form := infoCreateForm{
+		Agent:     r.PostForm.Get("agent"),
+		Material:  r.PostForm.Get("material"),
+		Equipment: r.PostForm.Get("equipment"),
+		Detail:    r.PostForm.Get("detail"),
+		Event:     r.PostForm.Get("event"),
+		Priority:  r.PostForm.Get("priority"),
+		Oups:      r.PostForm.Get("oups"),
+		Ameps:     r.PostForm.Get("ameps"),
+		Brips:     r.PostForm.Get("brips"),
+		Rte:       r.PostForm.Get("rte"),
+		Ais:       r.PostForm.Get("ais"),
+		Estimate:  r.PostForm.Get("estimate"),
+		Target:    r.PostForm.Get("target"),
+		Status:    r.PostForm.Get("status"),
+		Doneby:    r.PostForm.Get("doneby"),
+	}
 
+	equipmentID, err := app.readEquipment(r.Context(), &form, id)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/source/view/%d", sID),
-		http.StatusSeeOther)
-}
+	form.check()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderInfoForm(w, r, http.StatusUnprocessableEntity,
+			"infoCreate.tmpl.html", data, id)
+		return
+	}
+
+	info := &data.Info{
+		SourceID:    id,
+		Agent:       form.Agent,
+		Material:    form.Material,
+		EquipmentID: equipmentID,
+		Equipment:   form.Equipment,
+		Detail:      form.Detail,
+		Event:       form.Event,
+		Oups:        form.Oups,
+		Ameps:       form.Ameps,
+		Brips:       form.Brips,
+		Rte:         form.Rte,
+		Ais:         form.Ais,
+		Estimate:    form.Estimate,
+		Priority:    form.priority(),
+		Status:      form.Status,
+		Doneby:      form.Doneby,
+	}
+
+	// Already checked by check().
+	info.Target, _ = data.ParseDate(form.Target)
+
+	// Without target, the SLA of the priority gives it.
+	if info.Target == nil {
+		days, err := app.slas.Days(r.Context(), id, info.Priority)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		info.Target = data.SLATarget(time.Now(), days)
+	}
+
+	_, err = app.infos.Insert(r.Context(), info)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	logger := app.requestLogger(r)
+	app.notifyInfo(r.Context(), logger, nil, info)
+	app.infoEvents(r.Context(), logger, nil, info)
+
+	http.Redirect(w, r, fmt.Sprintf("/source/%d/info/create", id),
+		http.StatusSeeOther)
+}
+
+// Creates DB connection, read the URL and fetch "id", retrieves data from DB
+// with the specified "id".
+func (app *application) infoView(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	info, err := app.infos.Data(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Info = info
+
+	app.render(w, r, http.StatusOK, "infoView.tmpl.html", data)
+}
+
+// Same thing as sourceDeletePost but for a info.
+func (app *application) infoDeletePost(w http.ResponseWriter, r *http.Request) {
+	sKey := chi.URLParam(r, "sid")
+	iKey := chi.URLParam(r, "id")
+
+	id, err := strconv.Atoi(iKey)
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	sID, err := strconv.Atoi(sKey)
+	if err != nil || sID < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.infos.Delete(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	app.fireWebhooks(r.Context(), app.requestLogger(r), data.EventInfoDeleted,
+		webhookInfo{ID: id, SourceID: sID})
+
+	http.Redirect(w, r, fmt.Sprintf("/source/view/%d", sID),
+		http.StatusSeeOther)
+}
 
 // Same thing as sourceUpdate.
 // Creates connexion to DB and fetch the data that already exists so it can be
 // displayed for the user before beeing updated.
 func (app *application) infoUpdate(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
 	key := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(key)
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
-	info, err := app.info.Data(id, conn)
+	info, err := app.infos.Data(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrNoRows) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 
 		return
@@ -501,123 +953,1452 @@ func (app *application) infoUpdate(w http.ResponseWriter, r *http.Request) {
 
 	data := app.newTemplateData(r)
 	data.Info = info
+	data.Form = newInfoForm(info)
 
-	app.render(w, http.StatusOK, "infoUpdate.tmpl.html", data)
+	app.renderInfoForm(w, r, http.StatusOK, "infoUpdate.tmpl.html", data,
+		info.SourceID)
 }
 
 // same thing as sourceUpdatePost.
 func (app *application) infoUpdatePost(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
-
 	err := r.ParseForm()
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
+		return
 	}
 
 	sKey := chi.URLParam(r, "sid")
 	sID, err := strconv.Atoi(sKey)
 	if err != nil || sID < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
 	iKey := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(iKey)
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 
 	form := infoCreateForm{
-		Agent:    r.PostForm.Get("agent"),
-		Material: r.PostForm.Get("material"),
-		Detail:   r.PostForm.Get("detail"),
-		Event:    r.PostForm.Get("event"),
-		Priority: r.PostForm.Get("priority"),
-		Oups:     r.PostForm.Get("oups"),
-		Ameps:    r.PostForm.Get("ameps"),
-		Brips:    r.PostForm.Get("brips"),
-		Rte:      r.PostForm.Get("rte"),
-		Ais:      r.PostForm.Get("ais"),
-		Estimate: r.PostForm.Get("estimate"),
-		Target:   r.PostForm.Get("target"),
-		Status:   r.PostForm.Get("status"),
-		Doneby:   r.PostForm.Get("doneby"),
+		ID:        id,
+		Agent:     r.PostForm.Get("agent"),
+		Material:  r.PostForm.Get("material"),
+		Equipment: r.PostForm.Get("equipment"),
+		Detail:    r.PostForm.Get("detail"),
+		Event:     r.PostForm.Get("event"),
+		Priority:  r.PostForm.Get("priority"),
+		Oups:      r.PostForm.Get("oups"),
+		Ameps:     r.PostForm.Get("ameps"),
+		Brips:     r.PostForm.Get("brips"),
+		Rte:       r.PostForm.Get("rte"),
+		Ais:       r.PostForm.Get("ais"),
+		Estimate:  r.PostForm.Get("estimate"),
+		Target:    r.PostForm.Get("target"),
+		Status:    r.PostForm.Get("status"),
+		Doneby:    r.PostForm.Get("doneby"),
+		Version:   r.PostForm.Get("version"),
+	}
+
+	// The version is a hidden field of the form, it comes from the info
+	// that was displayed to the user.
+	version, err := strconv.Atoi(form.Version)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
 	}
 
-	app.info.Agent = form.Agent
-	app.info.Material = form.Material
-	app.info.Detail = form.Detail
-	app.info.Event = form.Event
-	app.info.Oups = form.Oups
-	app.info.Ameps = form.Ameps
-	app.info.Brips = form.Brips
-	app.info.Rte = form.Rte
-	app.info.Ais = form.Ais
-	app.info.Estimate = form.Estimate
-	app.info.Target = form.Target
-	app.info.Status = form.Status
-	app.info.Doneby = form.Doneby
-	app.info.Priority, err = strconv.Atoi(form.Priority)
+	equipmentID, err := app.readEquipment(r.Context(), &form, sID)
 	if err != nil {
-		app.notFound(w)
+		app.serverError(w, r, err)
 		return
 	}
 
-	err = app.info.Update(id, conn)
+	form.check()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderInfoForm(w, r, http.StatusUnprocessableEntity,
+			"infoUpdate.tmpl.html", data, sID)
+		return
+	}
+
+	info := &data.Info{
+		ID:          id,
+		SourceID:    sID,
+		Version:     version,
+		Agent:       form.Agent,
+		Material:    form.Material,
+		EquipmentID: equipmentID,
+		Equipment:   form.Equipment,
+		Detail:      form.Detail,
+		Event:       form.Event,
+		Oups:        form.Oups,
+		Ameps:       form.Ameps,
+		Brips:       form.Brips,
+		Rte:         form.Rte,
+		Ais:         form.Ais,
+		Estimate:    form.Estimate,
+		Priority:    form.priority(),
+		Status:      form.Status,
+		Doneby:      form.Doneby,
+	}
+
+	// Already checked by check().
+	info.Target, _ = data.ParseDate(form.Target)
+
+	// The info before the change tells which emails are due.
+	before, err := app.infos.Data(r.Context(), id)
+	if err != nil && !errors.Is(err, data.ErrNoRows) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.infos.Update(r.Context(), info)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, data.ErrEditConflict) {
+			app.infoConflict(w, r, id, form)
+		} else {
+			app.serverError(w, r, err)
+		}
+
 		return
 	}
 
+	logger := app.requestLogger(r)
+	app.notifyInfo(r.Context(), logger, before, info)
+
+	if before != nil {
+		app.infoEvents(r.Context(), logger, before, info)
+	}
+
 	http.Redirect(w, r, fmt.Sprintf("/source/%d/info/view/%d", sID, id),
 		http.StatusSeeOther)
 }
 
-func (app *application) importCSV(w http.ResponseWriter, r *http.Request) {
+// infoConflict() is called when the info has been modified by someone else
+// while the user was editing it. The current info is fetched again and a
+// page showing both versions field by field is sent with a 409 status.
+// The form keeps the user values but carries the current version, so the
+// user can merge them and submit again, or retry from the current info.
+func (app *application) infoConflict(w http.ResponseWriter, r *http.Request,
+	id int, form infoCreateForm) {
+
+	current, err := app.infos.Data(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	form.Version = strconv.Itoa(current.Version)
+
 	data := app.newTemplateData(r)
-	app.render(w, http.StatusOK, "importCSV.tmpl.html", data)
+	data.Info = current
+	data.Form = form
+	data.Conflicts = infoConflicts(form, current)
+
+	app.renderInfoForm(w, r, http.StatusConflict, "infoConflict.tmpl.html",
+		data, current.SourceID)
 }
 
-func (app *application) importCSVPost(w http.ResponseWriter, r *http.Request) {
-	conn := app.dbConn(r.Context())
-	defer conn.Release()
+// ##################
+// Equipment handlers
+// ##################
 
-	// Max size: 1MB
-	r.ParseMultipartForm(1_000_000)
+// equipmentForm creates or changes an item of the catalogue of a source.
+type equipmentForm struct {
+	Name         string
+	Bay          string
+	Type         string
+	Manufacturer string
+	Serial       string
+	Commissioned string
 
-	file, handler, err := r.FormFile("inpt")
+	validator.Validator
+}
+
+// newEquipmentForm() fills the form with the equipment so it can be edited.
+func newEquipmentForm(e *data.Equipment) equipmentForm {
+	return equipmentForm{
+		Name:         e.Name,
+		Bay:          e.Bay,
+		Type:         e.Type,
+		Manufacturer: e.Manufacturer,
+		Serial:       e.Serial,
+		Commissioned: e.CommissionedDate(),
+	}
+}
+
+// readEquipmentForm() parses and checks the form of an equipment. The
+// equipment is only complete when the form is valid.
+func readEquipmentForm(r *http.Request) (equipmentForm, *data.Equipment, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return equipmentForm{}, nil, err
+	}
+
+	form := equipmentForm{
+		Name:         strings.TrimSpace(r.PostForm.Get("name")),
+		Bay:          strings.TrimSpace(r.PostForm.Get("bay")),
+		Type:         strings.TrimSpace(r.PostForm.Get("type")),
+		Manufacturer: strings.TrimSpace(r.PostForm.Get("manufacturer")),
+		Serial:       strings.TrimSpace(r.PostForm.Get("serial")),
+		Commissioned: strings.TrimSpace(r.PostForm.Get("commissioned")),
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name",
+		"Ce champ ne doit pas être vide")
+	form.CheckField(form.Commissioned == "" ||
+		validator.IsDate(form.Commissioned, data.DateLayout),
+		"commissioned", "La date doit être au format AAAA-MM-JJ")
+
+	e := &data.Equipment{
+		Name:         form.Name,
+		Bay:          form.Bay,
+		Type:         form.Type,
+		Manufacturer: form.Manufacturer,
+		Serial:       form.Serial,
+	}
+
+	e.Commissioned, _ = data.ParseDate(form.Commissioned)
+
+	return form, e, nil
+}
+
+// equipmentList() displays the catalogue of the source and the form adding
+// an equipment.
+func (app *application) equipmentList(w http.ResponseWriter, r *http.Request) {
+	src, ok := app.readSource(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderCatalogue(w, r, http.StatusOK, src, equipmentForm{})
+}
+
+func (app *application) renderCatalogue(w http.ResponseWriter, r *http.Request,
+	status int, src *data.Source, form equipmentForm) {
+
+	catalogue, err := app.equipment.List(r.Context(), src.ID)
 	if err != nil {
-		app.errorLog.Println("Error retrieving the file")
-		app.errorLog.Println(err)
+		app.serverError(w, r, err)
 		return
 	}
 
-	defer file.Close()
+	data := app.newTemplateData(r)
+	data.Source = src
+	data.Catalogue = catalogue
+	data.Form = form
+
+	app.render(w, r, status, "equipmentList.tmpl.html", data)
+}
 
-	app.infoLog.Printf("Uploaded File: %+v\n", handler.Filename)
-	app.infoLog.Printf("File size: %+v\n", handler.Size)
-	app.infoLog.Printf("MIME Header: %+v\n", handler.Header)
+func (app *application) equipmentCreatePost(w http.ResponseWriter, r *http.Request) {
+	src, ok := app.readSource(w, r)
+	if !ok {
+		return
+	}
 
-	dst, err := os.Create("csvFiles/" + handler.Filename)
+	form, e, err := readEquipmentForm(r)
 	if err != nil {
-		app.errorLog.Println(w, err.Error(),
-			http.StatusInternalServerError)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
-	defer dst.Close()
 
-	// Copie the file and transfert it to the system.
-	if _, err := io.Copy(dst, file); err != nil {
-		app.errorLog.Println(w, err.Error(),
-			http.StatusInternalServerError)
+	if form.Valid() {
+		e.SourceID = src.ID
+
+		_, err = app.equipment.Insert(r.Context(), e)
+		if errors.Is(err, data.ErrDuplicate) {
+			form.AddFieldError("name", "La source a déjà un équipement de ce nom")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.renderCatalogue(w, r, http.StatusUnprocessableEntity, src, form)
 		return
 	}
 
-	// Run the extension verification et file encoding, if it's valid, the
-	// data will be transfert to DB.
-	app.csv.Verify("csvFiles/" + handler.Filename)
+	http.Redirect(w, r, fmt.Sprintf("/source/%d/equipment", src.ID),
+		http.StatusSeeOther)
+}
+
+// equipmentView() displays the equipment, its form and every curatif it had.
+func (app *application) equipmentView(w http.ResponseWriter, r *http.Request) {
+	e, ok := app.readEquipmentID(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderEquipment(w, r, http.StatusOK, e, newEquipmentForm(e))
+}
+
+func (app *application) renderEquipment(w http.ResponseWriter, r *http.Request,
+	status int, e *data.Equipment, form equipmentForm) {
+
+	src, err := app.sources.Data(r.Context(), e.SourceID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	history, err := app.equipment.History(r.Context(), e.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Source = src
+	data.Equipment = e
+	data.Infos = history
+	data.Form = form
+
+	app.render(w, r, status, "equipment.tmpl.html", data)
+}
+
+func (app *application) equipmentUpdatePost(w http.ResponseWriter, r *http.Request) {
+	stored, ok := app.readEquipmentID(w, r)
+	if !ok {
+		return
+	}
+
+	form, e, err := readEquipmentForm(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if form.Valid() {
+		e.ID = stored.ID
+
+		err = app.equipment.Update(r.Context(), e)
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+			return
+		} else if errors.Is(err, data.ErrDuplicate) {
+			form.AddFieldError("name", "La source a déjà un équipement de ce nom")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.renderEquipment(w, r, http.StatusUnprocessableEntity, stored, form)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/equipment/%d", stored.ID),
+		http.StatusSeeOther)
+}
+
+// equipmentDeletePost() removes the equipment from the catalogue, its
+// curatifs are kept.
+func (app *application) equipmentDeletePost(w http.ResponseWriter, r *http.Request) {
+	e, ok := app.readEquipmentID(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.equipment.Delete(r.Context(), e.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/source/%d/equipment", e.SourceID),
+		http.StatusSeeOther)
+}
+
+// readSource() fetches the source of the "id" URL parameter. On failure the
+// error response is sent and ok is false.
+func (app *application) readSource(w http.ResponseWriter,
+	r *http.Request) (*data.Source, bool) {
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	src, err := app.sources.Data(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return nil, false
+	}
+
+	return src, true
+}
+
+// readEquipmentID() fetches the equipment of the "id" URL parameter, like
+// readSource().
+func (app *application) readEquipmentID(w http.ResponseWriter,
+	r *http.Request) (*data.Equipment, bool) {
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	e, err := app.equipment.Data(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return nil, false
+	}
+
+	return e, true
+}
+
+// ####################
+// Saved views handlers
+// ####################
+
+// savedViewForm is the form saving the current filters of sourceView.
+// Filters is the query string of the filters.
+type savedViewForm struct {
+	Name     string
+	SourceID int
+	Filters  string
+	Pinned   bool
+	Shared   bool
+
+	validator.Validator
+}
+
+// readSavedView() checks the source and the filters of the view. The filters
+// are read like sourceView does, so only valid ones are saved, without the
+// page.
+func readSavedView(source, filters string) (savedViewForm, bool) {
+	form := savedViewForm{}
+
+	id, err := strconv.Atoi(source)
+	if err != nil || id < 1 {
+		return form, false
+	}
+
+	qs, err := url.ParseQuery(filters)
+	if err != nil {
+		return form, false
+	}
+
+	filterForm, _ := readSourceFilters(qs)
+	if !filterForm.Valid() {
+		return form, false
+	}
+
+	values := filterForm.values()
+	values.Del("page")
+
+	form.SourceID = id
+	form.Filters = values.Encode()
+
+	return form, true
+}
+
+// viewCreate() displays the form saving the filters of the sourceView page.
+// Exemple: /views/create?source=3&filters=status%3Daffect%C3%A9
+func (app *application) viewCreate(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	form, ok := readSavedView(qs.Get("source"), qs.Get("filters"))
+	if !ok {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	src, err := app.sources.Data(r.Context(), form.SourceID)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Source = src
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "viewCreate.tmpl.html", data)
+}
+
+func (app *application) viewCreatePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form, ok := readSavedView(r.PostForm.Get("source"),
+		r.PostForm.Get("filters"))
+	if !ok {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form.Name = strings.TrimSpace(r.PostForm.Get("name"))
+	form.Pinned = r.PostForm.Get("pinned") != ""
+	form.Shared = r.PostForm.Get("shared") != ""
+
+	form.CheckField(validator.NotBlank(form.Name), "name",
+		"Ce champ ne doit pas être vide")
+
+	src, err := app.sources.Data(r.Context(), form.SourceID)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Source = src
+		data.Form = form
+
+		app.render(w, r, http.StatusUnprocessableEntity,
+			"viewCreate.tmpl.html", data)
+		return
+	}
+
+	v := &data.SavedView{
+		UserID:   app.contextGetUser(r).ID,
+		SourceID: form.SourceID,
+		Name:     form.Name,
+		Query:    form.Filters,
+		Pinned:   form.Pinned,
+		Shared:   form.Shared,
+	}
+
+	_, err = app.views.Insert(r.Context(), v)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/views", http.StatusSeeOther)
+}
+
+// viewList() lists the views of the user, then the ones shared by its team.
+func (app *application) viewList(w http.ResponseWriter, r *http.Request) {
+	views, err := app.views.ForUser(r.Context(), app.contextGetUser(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.countViews(r.Context(), views)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Views = views
+
+	app.render(w, r, http.StatusOK, "views.tmpl.html", data)
+}
+
+// viewOpen() redirects to the sourceView page with the filters of the view.
+func (app *application) viewOpen(w http.ResponseWriter, r *http.Request) {
+	v, ok := app.readView(w, r)
+	if !ok {
+		return
+	}
+
+	http.Redirect(w, r, viewURL(v), http.StatusSeeOther)
+}
+
+// viewUpdatePost() pins/unpins or shares/unshares a view of the user. The
+// form sends the new values of "pinned" and "shared".
+func (app *application) viewUpdatePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	v, ok := app.readView(w, r)
+	if !ok {
+		return
+	}
+
+	if v.UserID != app.contextGetUser(r).ID {
+		app.clientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	v.Pinned = r.PostForm.Get("pinned") != ""
+	v.Shared = r.PostForm.Get("shared") != ""
+
+	err = app.views.Update(r.Context(), v)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/views", http.StatusSeeOther)
+}
+
+func (app *application) viewDeletePost(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.views.Delete(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	http.Redirect(w, r, "/views", http.StatusSeeOther)
+}
+
+// readView() fetches the view of the URL. It sends the error response and
+// returns false if it can't.
+func (app *application) readView(w http.ResponseWriter,
+	r *http.Request) (*data.SavedView, bool) {
+
+	key := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	v, err := app.views.Data(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return nil, false
+	}
+
+	return v, true
+}
+
+// countViews() sets the number of infos matching each view.
+func (app *application) countViews(ctx context.Context,
+	views []*data.SavedView) error {
+
+	for _, v := range views {
+		qs, _ := url.ParseQuery(v.Query)
+
+		_, filters := readSourceFilters(qs)
+		filters.PageSize = 1
+
+		_, metadata, err := app.infos.List(ctx, v.SourceID, filters)
+		if err != nil {
+			return err
+		}
+
+		v.Count = metadata.TotalRecords
+	}
+
+	return nil
+}
+
+// viewURL() returns the sourceView page with the filters of the view.
+func viewURL(v *data.SavedView) string {
+	u := fmt.Sprintf("/source/view/%d", v.SourceID)
+	if v.Query != "" {
+		u += "?" + v.Query
+	}
+
+	return u
+}
+
+// SaveViewURL() returns the link saving the current filters as a view.
+func (f sourceFilterForm) SaveViewURL(sourceID int) string {
+	values := f.values()
+	values.Del("page")
+
+	qs := url.Values{}
+	qs.Set("source", strconv.Itoa(sourceID))
+	qs.Set("filters", values.Encode())
+
+	return "/views/create?" + qs.Encode()
+}
+
+// ###############
+// Search handlers
+// ###############
+
+// searchForm holds the query string of the search page, so the fields keep
+// their values between two searches.
+type searchForm struct {
+	Query    string
+	Source   string
+	Status   string
+	Priority string
+
+	validator.Validator
+}
+
+// readSearch() reads the search criteria from the query string.
+// Exemple: /search?q=disjoncteur&source=3&status=affecté&priority=1
+func readSearch(qs url.Values) (searchForm, data.SearchFilters) {
+	form := searchForm{
+		Query:    strings.TrimSpace(qs.Get("q")),
+		Source:   qs.Get("source"),
+		Status:   qs.Get("status"),
+		Priority: qs.Get("priority"),
+	}
+
+	f := data.SearchFilters{Query: form.Query, Status: form.Status}
+
+	if form.Source != "" {
+		form.CheckField(validator.IsNumber(form.Source), "source",
+			"Source inconnue")
+		f.SourceID, _ = strconv.Atoi(form.Source)
+	}
+
+	if form.Priority != "" {
+		form.CheckField(validator.IsNumber(form.Priority), "priority",
+			"La priorité doit être un nombre")
+		f.Priority, _ = strconv.Atoi(form.Priority)
+	}
+
+	if form.Status != "" {
+		form.CheckField(validator.PermittedValue(form.Status, searchStatuses...),
+			"status", "Statut inconnu")
+	}
+
+	return form, f
+}
+
+// The archived infos can be searched too.
+var searchStatuses = append(append([]string{}, statuses...), "archivé")
+
+// search() displays the search page, with the results once a criterion is
+// given.
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	form, filters := readSearch(r.URL.Query())
+
+	sources, err := app.sources.GetAllActive(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sources = sources
+
+	searching := form.Query != "" || form.Source != "" ||
+		form.Status != "" || form.Priority != ""
+
+	if searching && form.Valid() {
+		data.Results, err = app.infos.Search(r.Context(), filters)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data.Form = form
+
+	status := http.StatusOK
+	if !form.Valid() {
+		status = http.StatusUnprocessableEntity
+	}
+
+	app.render(w, r, status, "search.tmpl.html", data)
+}
+
+// ############
+// SLA handlers
+// ############
+
+// slaForm sets the days of a priority, for every source if Source is empty.
+type slaForm struct {
+	Source   string
+	Priority string
+	Days     string
+
+	validator.Validator
+}
+
+// slaReport is displayed by the slaReport page. The stats are summed per
+// source and per month, Total sums all of them.
+type slaReport struct {
+	Months   int
+	Stats    []*data.SLAStat
+	BySource []*data.SLAStat
+	ByMonth  []*data.SLAStat
+	Total    *data.SLAStat
+}
+
+// Number of months of the report by default, and at most. slaMonths are
+// the periods proposed by the page.
+const (
+	defaultSLAMonths = 12
+	maxSLAMonths     = 36
+)
+
+var slaMonths = []int{3, 6, 12, 24, maxSLAMonths}
+
+// slaList() displays the rules, with the forms changing them.
+func (app *application) slaList(w http.ResponseWriter, r *http.Request) {
+	app.renderSLA(w, r, http.StatusOK, slaForm{})
+}
+
+func (app *application) renderSLA(w http.ResponseWriter, r *http.Request,
+	status int, form slaForm) {
+
+	rules, err := app.slas.List(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sources, err := app.sources.GetAllActive(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.SLAs = rules
+	data.Sources = sources
+	data.Form = form
+
+	app.render(w, r, status, "sla.tmpl.html", data)
+}
+
+// slaSetPost() creates or changes a rule. Without source, the default rule
+// of the priority is changed.
+func (app *application) slaSetPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := slaForm{
+		Source:   r.PostForm.Get("source"),
+		Priority: r.PostForm.Get("priority"),
+		Days:     strings.TrimSpace(r.PostForm.Get("days")),
+	}
+
+	rule := &data.SLA{}
+
+	if form.Source != "" {
+		rule.SourceID, err = strconv.Atoi(form.Source)
+		form.CheckField(err == nil && rule.SourceID > 0, "source",
+			"Source inconnue")
+	}
+
+	rule.Priority, err = strconv.Atoi(form.Priority)
+	form.CheckField(err == nil &&
+		validator.PermittedValue(rule.Priority, priorities...),
+		"priority", "Priorité inconnue")
+
+	rule.Days, err = strconv.Atoi(form.Days)
+	form.CheckField(err == nil && rule.Days > 0, "days",
+		"Le délai doit être un nombre de jours supérieur à 0")
+
+	if form.Valid() {
+		err = app.slas.Set(r.Context(), rule)
+		if errors.Is(err, data.ErrNoRows) {
+			form.AddFieldError("source", "Source inconnue")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.renderSLA(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	http.Redirect(w, r, "/sla", http.StatusSeeOther)
+}
+
+// slaDeletePost() deletes the override of a source, the default rule of the
+// priority applies again.
+func (app *application) slaDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.slas.Delete(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	http.Redirect(w, r, "/sla", http.StatusSeeOther)
+}
+
+// slaReportView() shows the percentage of infos resolved on time, per source
+// and per month, over the last months (?months=12).
+func (app *application) slaReportView(w http.ResponseWriter, r *http.Request) {
+	months := defaultSLAMonths
+
+	if qs := r.URL.Query().Get("months"); qs != "" {
+		n, err := strconv.Atoi(qs)
+		if err != nil || n < 1 || n > maxSLAMonths {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		months = n
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month()-time.Month(months-1), 1, 0, 0, 0,
+		0, time.UTC)
+
+	stats, err := app.slas.Stats(r.Context(), from)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	report := &slaReport{
+		Months: months,
+		Stats:  stats,
+		BySource: data.SumSLAStats(stats, func(s *data.SLAStat) data.SLAStat {
+			return data.SLAStat{SourceID: s.SourceID, Source: s.Source}
+		}),
+		ByMonth: data.SumSLAStats(stats, func(s *data.SLAStat) data.SLAStat {
+			return data.SLAStat{Month: s.Month}
+		}),
+		Total: &data.SLAStat{},
+	}
+
+	for _, s := range stats {
+		report.Total.Total += s.Total
+		report.Total.OnTime += s.OnTime
+	}
+
+	data := app.newTemplateData(r)
+	data.Report = report
+
+	app.render(w, r, http.StatusOK, "slaReport.tmpl.html", data)
+}
+
+// #########################
+// Recurring report handlers
+// #########################
+
+// recurringReport is displayed by the recurring page: the equipment (or
+// materials) having at least Min infos over the last Months, and the ones
+// having several open infos, likely duplicates.
+type recurringReport struct {
+	Months     int
+	Min        int
+	Recurring  []*data.Recurrence
+	Duplicates []*data.Recurrence
+}
+
+// Defaults of the report, and its limits. recurringMonths are the periods
+// proposed by the page.
+const (
+	defaultRecurringMonths = 12
+	defaultRecurringMin    = 3
+	maxRecurringMonths     = 36
+	maxRecurringMin        = 50
+)
+
+var recurringMonths = []int{3, 6, 12, 24, maxRecurringMonths}
+
+// recurringView() flags the repeated defects (?months=12&min=3), so they can
+// be escalated to a preventive replacement.
+func (app *application) recurringView(w http.ResponseWriter, r *http.Request) {
+	report := &recurringReport{
+		Months: defaultRecurringMonths,
+		Min:    defaultRecurringMin,
+	}
+
+	qs := r.URL.Query()
+
+	if v := qs.Get("months"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRecurringMonths {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		report.Months = n
+	}
+
+	if v := qs.Get("min"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 || n > maxRecurringMin {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		report.Min = n
+	}
+
+	from := time.Now().UTC().AddDate(0, -report.Months, 0)
+
+	var err error
+
+	report.Recurring, err = app.infos.Recurring(r.Context(),
+		data.RecurringFilters{From: from, Min: report.Min})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	report.Duplicates, err = app.infos.Recurring(r.Context(),
+		data.RecurringFilters{Min: 2, OpenOnly: true})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Recurring = report
+
+	app.render(w, r, http.StatusOK, "recurring.tmpl.html", data)
+}
+
+// ################
+// Webhook handlers
+// ################
+
+// Number of deliveries shown by the page of a webhook.
+const webhookLogSize = 50
+
+// webhookForm creates or changes a webhook. No event checked means every
+// event.
+type webhookForm struct {
+	URL    string
+	Events []string
+	Active bool
+
+	validator.Validator
+}
+
+// Has() tells the template if the event is checked.
+func (f webhookForm) Has(event string) bool {
+	for _, e := range f.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readWebhookForm() parses and checks the form of a webhook.
+func readWebhookForm(r *http.Request) (webhookForm, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return webhookForm{}, err
+	}
+
+	form := webhookForm{
+		URL:    strings.TrimSpace(r.PostForm.Get("url")),
+		Events: r.PostForm["events"],
+		Active: r.PostForm.Get("active") != "",
+	}
+
+	u, err := url.Parse(form.URL)
+	form.CheckField(err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+		u.Host != "", "url", "Ce champ doit être une URL http(s)")
+
+	for _, e := range form.Events {
+		form.CheckField(validator.PermittedValue(e, data.WebhookEvents...),
+			"events", "Évènement inconnu")
+	}
+
+	return form, nil
+}
+
+// webhookList() displays the webhooks and the form creating one.
+func (app *application) webhookList(w http.ResponseWriter, r *http.Request) {
+	app.renderWebhooks(w, r, http.StatusOK, webhookForm{Active: true})
+}
+
+func (app *application) renderWebhooks(w http.ResponseWriter, r *http.Request,
+	status int, form webhookForm) {
+
+	hooks, err := app.webhooks.List(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhooks = hooks
+	data.Form = form
+
+	app.render(w, r, status, "webhooks.tmpl.html", data)
+}
+
+// webhookCreatePost() creates the webhook with a random secret, shown on its
+// page.
+func (app *application) webhookCreatePost(w http.ResponseWriter, r *http.Request) {
+	form, err := readWebhookForm(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if !form.Valid() {
+		app.renderWebhooks(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	hook := &data.Webhook{
+		URL:    form.URL,
+		Secret: secret,
+		Events: form.Events,
+		Active: form.Active,
+	}
+
+	id, err := app.webhooks.Insert(r.Context(), hook)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/webhooks/%d", id), http.StatusSeeOther)
+}
+
+// webhookView() displays the webhook, its form and the log of its last
+// deliveries.
+func (app *application) webhookView(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	form := webhookForm{URL: hook.URL, Events: hook.Events, Active: hook.Active}
+
+	app.renderWebhook(w, r, http.StatusOK, hook, form)
+}
+
+func (app *application) renderWebhook(w http.ResponseWriter, r *http.Request,
+	status int, hook *data.Webhook, form webhookForm) {
+
+	deliveries, err := app.webhooks.Deliveries(r.Context(), hook.ID,
+		webhookLogSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhook = hook
+	data.Deliveries = deliveries
+	data.MaxAttempts = app.config.webhook.maxAttempts
+	data.Form = form
+
+	app.render(w, r, status, "webhook.tmpl.html", data)
+}
+
+func (app *application) webhookUpdatePost(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	form, err := readWebhookForm(r)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if !form.Valid() {
+		app.renderWebhook(w, r, http.StatusUnprocessableEntity, hook, form)
+		return
+	}
+
+	hook.URL = form.URL
+	hook.Events = form.Events
+	hook.Active = form.Active
+
+	err = app.webhooks.Update(r.Context(), hook)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/webhooks/%d", hook.ID),
+		http.StatusSeeOther)
+}
+
+func (app *application) webhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.webhooks.Delete(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// webhookRedeliverPost() sends again the payload of a delivery, whatever its
+// outcome. A new delivery is queued, the log keeps the old one.
+func (app *application) webhookRedeliverPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	d, err := app.webhooks.Redeliver(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	app.requestLogger(r).Info("webhook redelivery queued", "delivery_id", id,
+		"new_delivery_id", d.ID, "webhook_id", d.WebhookID)
+
+	http.Redirect(w, r, fmt.Sprintf("/webhooks/%d", d.WebhookID),
+		http.StatusSeeOther)
+}
+
+// readWebhook() fetches the webhook of the "id" URL parameter. On failure
+// the error response is sent and ok is false.
+func (app *application) readWebhook(w http.ResponseWriter,
+	r *http.Request) (*data.Webhook, bool) {
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return nil, false
+	}
+
+	hook, err := app.webhooks.Data(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return nil, false
+	}
+
+	return hook, true
+}
+
+// #################################
+// Notification preferences handlers
+// #################################
+
+// notificationsForm is the form of the emails wanted by the user.
+type notificationsForm struct {
+	Email    string
+	Assigned bool
+	Overdue  bool
+	Resolved bool
+	Digest   string
+
+	validator.Validator
+}
+
+func (app *application) accountNotifications(w http.ResponseWriter,
+	r *http.Request) {
+
+	u := app.contextGetUser(r)
+
+	data := app.newTemplateData(r)
+	data.Form = notificationsForm{
+		Email:    u.Email,
+		Assigned: u.NotifyAssigned,
+		Overdue:  u.NotifyOverdue,
+		Resolved: u.NotifyResolved,
+		Digest:   u.Digest,
+	}
+
+	app.render(w, r, http.StatusOK, "accountNotifications.tmpl.html", data)
+}
+
+func (app *application) accountNotificationsPost(w http.ResponseWriter,
+	r *http.Request) {
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := notificationsForm{
+		Email:    strings.TrimSpace(r.PostForm.Get("email")),
+		Assigned: r.PostForm.Get("assigned") != "",
+		Overdue:  r.PostForm.Get("overdue") != "",
+		Resolved: r.PostForm.Get("resolved") != "",
+		Digest:   r.PostForm.Get("digest"),
+	}
+
+	form.CheckField(validator.PermittedValue(form.Digest, "",
+		data.DigestDaily, data.DigestWeekly), "digest", "Valeur invalide")
+	form.CheckField(form.Email == "" || validator.IsEmail(form.Email),
+		"email", "Adresse email invalide")
+
+	// Without address, no email can be sent.
+	form.CheckField(form.Email != "" ||
+		!(form.Assigned || form.Overdue || form.Resolved ||
+			form.Digest != ""), "email",
+		"Une adresse est nécessaire pour recevoir des emails")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+
+		app.render(w, r, http.StatusUnprocessableEntity,
+			"accountNotifications.tmpl.html", data)
+		return
+	}
+
+	u := *app.contextGetUser(r)
+	u.Email = form.Email
+	u.NotifyAssigned = form.Assigned
+	u.NotifyOverdue = form.Overdue
+	u.NotifyResolved = form.Resolved
+	u.Digest = form.Digest
+
+	err = app.users.SetPreferences(r.Context(), &u)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/account/notifications", http.StatusSeeOther)
+}
+
+func (app *application) importCSV(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	app.render(w, r, http.StatusOK, "importCSV.tmpl.html", data)
+}
+
+func (app *application) importCSVPost(w http.ResponseWriter, r *http.Request) {
+	// Max size: 1MB
+	r.ParseMultipartForm(1_000_000)
+
+	logger := app.requestLogger(r)
+
+	file, handler, err := r.FormFile("inpt")
+	if err != nil {
+		logger.Error("error retrieving the file", "error", err)
+		app.metrics.imports.Inc("failure")
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	defer file.Close()
+
+	logger.Info("file uploaded", "file", handler.Filename,
+		"size", handler.Size, "content_type",
+		handler.Header.Get("Content-Type"))
+
+	// Only keep the file name so the upload can't be written outside of
+	// csvFiles/.
+	path := filepath.Join("csvFiles", filepath.Base(handler.Filename))
+
+	dst, err := os.Create(path)
+	if err != nil {
+		app.metrics.imports.Inc("failure")
+		app.serverError(w, r, err)
+		return
+	}
+	defer dst.Close()
+
+	// Copie the file and transfert it to the system.
+	if _, err := io.Copy(dst, file); err != nil {
+		app.metrics.imports.Inc("failure")
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Run the extension verification et file encoding, if it's valid, the
+	// data will be transfert to DB.
+	err = app.csv.Verify(path)
+	if err != nil {
+		logger.Error("import failed", "file", path, "error", err)
+		app.metrics.imports.Inc("failure")
+		app.clientError(w, r, http.StatusUnprocessableEntity)
+		return
+	}
+
+	app.metrics.imports.Inc("success")
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"e-curatif/internal/data"
+)
+
+// Links of the infos in sourceView: source ID, info ID and material.
+var infoLinkRX = regexp.MustCompile(`href='/source/(\d+)/info/view/(\d+)'>([^<]*)<`)
+
+// Each request must work on its own values: the sources and infos created
+// concurrently are all listed once, each with its own data. Run it with
+// go test -race.
+func TestConcurrentRequests(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	const workers = 16
+	const infosPerSource = 3
+
+	t.Run("group", func(t *testing.T) {
+		for n := 0; n < workers; n++ {
+			n := n
+
+			t.Run(fmt.Sprintf("worker %d", n), func(t *testing.T) {
+				t.Parallel()
+
+				name := fmt.Sprintf("poste-%02d", n)
+
+				code, header, _ := ts.postForm(t, "/source/create",
+					url.Values{"name": {name}})
+				if code != http.StatusSeeOther {
+					t.Fatalf("source create: got status %d", code)
+				}
+
+				sourceURL := header.Get("Location")
+				id, err := strconv.Atoi(strings.TrimPrefix(sourceURL, "/source/view/"))
+				if err != nil {
+					t.Fatalf("source create: got location %q", sourceURL)
+				}
+
+				material := fmt.Sprintf("materiel-%02d", n)
+
+				for i := 0; i < infosPerSource; i++ {
+					form := url.Values{
+						"agent":    {fmt.Sprintf("agent-%02d", n)},
+						"material": {material},
+						"detail":   {fmt.Sprintf("detail-%02d-%d", n, i)},
+						"event":    {"ronde"},
+						"priority": {"2"},
+						"status":   {"en attente"},
+					}
+
+					code, _, _ := ts.postForm(t,
+						fmt.Sprintf("/source/%d/info/create", id), form)
+					if code != http.StatusSeeOther {
+						t.Fatalf("info create: got status %d", code)
+					}
+				}
+
+				code, _, body := ts.get(t, sourceURL)
+				if code != http.StatusOK {
+					t.Fatalf("source view: got status %d", code)
+				}
+
+				if !strings.Contains(body, name) {
+					t.Errorf("source view: %q missing", name)
+				}
+
+				links := infoLinkRX.FindAllStringSubmatch(body, -1)
+				if len(links) != infosPerSource {
+					t.Fatalf("source view: got %d infos, want %d", len(links),
+						infosPerSource)
+				}
+
+				seen := map[string]bool{}
+
+				for _, l := range links {
+					if l[1] != strconv.Itoa(id) || l[3] != material {
+						t.Errorf("source view: got info %s of source %s (%q)",
+							l[2], l[1], l[3])
+					}
+
+					if seen[l[2]] {
+						t.Errorf("source view: info %s listed twice", l[2])
+					}
+					seen[l[2]] = true
+
+					code, _, body := ts.get(t,
+						fmt.Sprintf("/source/%s/info/view/%s", l[1], l[2]))
+					if code != http.StatusOK {
+						t.Fatalf("info view: got status %d", code)
+					}
+
+					if !strings.Contains(body, material) ||
+						!strings.Contains(body, fmt.Sprintf("agent-%02d", n)) {
+						t.Errorf("info view %s: values of another request", l[2])
+					}
+				}
+			})
+		}
+	})
+
+	_, _, body := ts.get(t, "/")
+
+	for n := 0; n < workers; n++ {
+		name := fmt.Sprintf("poste-%02d", n)
+
+		if got := strings.Count(body, ">"+name+"<"); got != 1 {
+			t.Errorf("home: %q listed %d times", name, got)
+		}
+	}
+}
+
+// Concurrent edits of the same version: only one of them is saved, the
+// others get the conflict page, and the info isn't mixed up.
+func TestConcurrentInfoUpdates(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.postForm(t, "/source/create", url.Values{"name": {"Lyon"}})
+
+	form := url.Values{
+		"agent":    {"dupont"},
+		"material": {"TR 1"},
+		"detail":   {"fuite"},
+		"event":    {"ronde"},
+		"priority": {"2"},
+		"status":   {"en attente"},
+	}
+
+	code, _, _ := ts.postForm(t, "/source/1/info/create", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("info create: got status %d", code)
+	}
+
+	const editors = 8
+
+	var mu sync.Mutex
+	statuses := map[int]int{}
+
+	t.Run("group", func(t *testing.T) {
+		for n := 0; n < editors; n++ {
+			n := n
+
+			t.Run(fmt.Sprintf("editor %d", n), func(t *testing.T) {
+				t.Parallel()
+
+				edit := url.Values{}
+				for k, v := range form {
+					edit[k] = v
+				}
+
+				edit.Set("agent", fmt.Sprintf("editor-%d", n))
+				edit.Set("detail", fmt.Sprintf("detail-%d", n))
+				edit.Set("version", "1")
+
+				code, _, _ := ts.postForm(t, "/source/1/info/update/1", edit)
+
+				mu.Lock()
+				statuses[code]++
+				mu.Unlock()
+			})
+		}
+	})
+
+	if statuses[http.StatusSeeOther] != 1 ||
+		statuses[http.StatusConflict] != editors-1 {
+		t.Fatalf("got statuses %v, want 1 saved and %d conflicts", statuses,
+			editors-1)
+	}
+
+	_, _, body := ts.get(t, "/source/1/info/view/1")
+
+	// The agent and the detail come from the same edit.
+	m := regexp.MustCompile(`editor-(\d)`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatal("info view: no edit saved")
+	}
+
+	if !strings.Contains(body, "detail-"+m[1]) {
+		t.Errorf("info view: agent of editor %s with another detail", m[1])
+	}
+}
+
+func TestSourceViewPage(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.postForm(t, "/source/create", url.Values{"name": {"Lyon"}})
+
+	tests := []struct {
+		page string
+		want int
+	}{
+		{"", http.StatusOK},
+		{"1", http.StatusOK},
+		{"3", http.StatusOK},
+		{"0", http.StatusUnprocessableEntity},
+		{"-1", http.StatusUnprocessableEntity},
+		{"deux", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		path := "/source/view/1?" + url.Values{"page": {tt.page}}.Encode()
+
+		if code, _, _ := ts.get(t, path); code != tt.want {
+			t.Errorf("page %q: got status %d, want %d", tt.page, code, tt.want)
+		}
+	}
+}
+
+// A blank delay is the global value, 0 disables the archiving of the source.
+func TestSourceArchiveAfter(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		archiveAfter string
+		want         string
+	}{
+		{"", ""},
+		{"0", "Pas d'archivage automatique"},
+		{"12", "Archivage après 12 jours"},
+	}
+
+	for n, tt := range tests {
+		code, header, _ := ts.postForm(t, "/source/create", url.Values{
+			"name":          {fmt.Sprintf("poste-%d", n)},
+			"archive_after": {tt.archiveAfter},
+		})
+		if code != http.StatusSeeOther {
+			t.Fatalf("%q: got status %d", tt.archiveAfter, code)
+		}
+
+		_, _, body := ts.get(t, header.Get("Location"))
+
+		got := ""
+		for _, s := range []string{"Pas d'archivage automatique",
+			"Archivage après 12 jours"} {
+			if strings.Contains(body, s) {
+				got = s
+			}
+		}
+
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.archiveAfter, got, tt.want)
+		}
+	}
+}
+
+// The address of the notifications must be written as is in the To header.
+func TestNotificationsEmail(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		email string
+		want  int
+	}{
+		{"", http.StatusSeeOther},
+		{"dupont@exemple.fr", http.StatusSeeOther},
+		{"dupont..jean@exemple.fr", http.StatusUnprocessableEntity},
+		{"Dupont <dupont@exemple.fr>", http.StatusUnprocessableEntity},
+		{"dupont@exemple.fr\r\nBcc: pirate@exemple.fr",
+			http.StatusUnprocessableEntity},
+		{"dupont", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		code, _, _ := ts.do(t, http.MethodPost, "/account/notifications",
+			"dupont", "application/x-www-form-urlencoded",
+			url.Values{"email": {tt.email}}.Encode())
+		if code != tt.want {
+			t.Errorf("%q: got status %d, want %d", tt.email, code, tt.want)
+		}
+	}
+}
+
+// The info forms are checked like the API: a missing field or a priority
+// which isn't a number re-renders the form, and nothing is saved.
+func TestInfoFormChecks(t *testing.T) {
+	app, models := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.postForm(t, "/source/create", url.Values{"name": {"Lyon"}})
+
+	valid := func() url.Values {
+		return url.Values{"agent": {"dupont"}, "material": {"TR 1"},
+			"detail": {"fuite"}, "event": {"ronde"}, "priority": {"2"},
+			"status": {"en attente"}, "version": {"1"}}
+	}
+
+	code, _, _ := ts.postForm(t, "/source/1/info/create", valid())
+	if code != http.StatusSeeOther {
+		t.Fatalf("create: got status %d", code)
+	}
+
+	tests := []struct {
+		field string
+		value string
+		want  string
+	}{
+		{"priority", "deux", "La priorité doit être un nombre supérieur à 0"},
+		{"priority", "0", "La priorité doit être un nombre supérieur à 0"},
+		{"priority", "", "Ce champ ne doit pas être vide"},
+		{"agent", " ", "Ce champ ne doit pas être vide"},
+		{"detail", "", "Ce champ ne doit pas être vide"},
+		{"status", "", "Ce champ ne doit pas être vide"},
+	}
+
+	for _, path := range []string{"/source/1/info/create",
+		"/source/1/info/update/1"} {
+
+		for _, tt := range tests {
+			form := valid()
+			form.Set(tt.field, tt.value)
+
+			code, _, body := ts.postForm(t, path, form)
+			if code != http.StatusUnprocessableEntity ||
+				!strings.Contains(body, tt.want) {
+				t.Errorf("%s, %s %q: got status %d", path, tt.field, tt.value,
+					code)
+			}
+		}
+	}
+
+	i, err := models.Infos.Data(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i.Version != 1 || i.Priority != 2 || i.Agent != "dupont" {
+		t.Errorf("got info %+v, want it unchanged", i)
+	}
+}
+
+// An invalid source ID in the delete URL is a 404, the info is kept.
+func TestInfoDeleteSourceID(t *testing.T) {
+	app, models := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	ts.postForm(t, "/source/create", url.Values{"name": {"Lyon"}})
+
+	_, err := models.Infos.Insert(context.Background(), &data.Info{
+		SourceID: 1, Agent: "dupont", Material: "TR 1", Detail: "fuite",
+		Event: "ronde", Priority: 2, Status: "en attente"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sid  string
+		want int
+	}{
+		{"0", http.StatusNotFound},
+		{"-1", http.StatusNotFound},
+		{"lyon", http.StatusNotFound},
+		{"1", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		code, _, _ := ts.postForm(t, "/source/"+tt.sid+"/info/delete/1", nil)
+		if code != tt.want {
+			t.Errorf("source %q: got status %d, want %d", tt.sid, code, tt.want)
+		}
+
+		_, err := models.Infos.Data(context.Background(), 1)
+		if deleted := errors.Is(err, data.ErrNoRows); deleted !=
+			(tt.want == http.StatusSeeOther) {
+			t.Errorf("source %q: got deleted %t (%v)", tt.sid, deleted, err)
+		}
+	}
+}
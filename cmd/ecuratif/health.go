@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// ######################
+// Supervisor endpoints
+// ######################
+
+// healthz() only tells the process is alive and able to answer.
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// readyz() tells if the app can serve requests: the DB answers, every
+// migration is applied and the templates are loaded. If one check fails a
+// 503 is sent with the detail of each check. Nothing is written to the DB,
+// a missing schema_migrations table only means not ready.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	checks := map[string]string{
+		"database":   "ok",
+		"migrations": "ok",
+		"templates":  "ok",
+	}
+
+	ready := true
+
+	if err := app.DB.Ping(ctx); err != nil {
+		checks["database"] = err.Error()
+		ready = false
+	}
+
+	pending, err := app.migrator.Pending(ctx)
+	switch {
+	case err != nil:
+		checks["migrations"] = err.Error()
+		ready = false
+	case pending > 0:
+		checks["migrations"] = "pending migrations"
+		ready = false
+	}
+
+	if len(app.templateCache) == 0 {
+		checks["templates"] = "template cache is empty"
+		ready = false
+	}
+
+	status := http.StatusOK
+	env := envelope{"status": "ready", "checks": checks}
+
+	if !ready {
+		status = http.StatusServiceUnavailable
+		env["status"] = "unavailable"
+		w.Header().Set("Retry-After", "5")
+	}
+
+	err = app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// versionInfo() sends the build information of the binary.
+func (app *application) versionInfo(w http.ResponseWriter, r *http.Request) {
+	rev, date := buildInfo()
+
+	env := envelope{
+		"version":    version,
+		"commit":     rev,
+		"build_date": date,
+		"go":         runtime.Version(),
+		"env":        app.config.env,
+	}
+
+	err := app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// buildInfo() returns the commit and build date set with -ldflags, or the
+// VCS revision and time embedded by "go build" if they weren't set.
+func buildInfo() (rev, date string) {
+	rev, date = commit, buildDate
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return rev, date
+	}
+
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && rev == "":
+			rev = s.Value
+		case s.Key == "vcs.time" && date == "":
+			date = s.Value
+		}
+	}
+
+	return rev, date
+}
@@ -2,55 +2,125 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
+
+	"e-curatif/internal/data"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/puddle/v2"
 )
 
-// serverError() helper writes an error message and stack trace to the errorLog,
-// then sends a generic 500 Internal Server Error responder to the user.
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+// serverError() helper logs the error message and stack trace, then sends a
+// generic 500 Internal Server Error page to the user (JSON for the API).
+// In development the error and the trace are shown in the page.
+// If the error comes from the DB not being reachable, a 503 Service
+// Unavailable is sent instead so the user knows it's worth retrying.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request,
+	err error) {
+
+	logger := app.requestLogger(r)
+
+	if dbUnavailable(err) {
+		logger.Warn("DB unavailable", "error", err)
+		app.serviceUnavailable(w, r)
+		return
+	}
 
-	app.errorLog.Output(2, trace)
+	trace := string(debug.Stack())
+	logger.Error(err.Error(), "trace", trace)
+
+	detail := ""
+	if app.config.isDevelopment() {
+		detail = fmt.Sprintf("%s\n\n%s", err, trace)
+	}
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError),
-		http.StatusInternalServerError)
+	app.errorPage(w, r, http.StatusInternalServerError, detail)
 }
 
 // clientError() helper sends a specific status code and corresponding
-// description to the user.
+// error page to the user.
 // Exemple: 400 "Bad Request" when there's a problem with te request that the
 // user sent.
-func (app *application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
+func (app *application) clientError(w http.ResponseWriter, r *http.Request,
+	status int) {
+
+	app.errorPage(w, r, status, "")
 }
 
 // notFound() uses clientError() method to generate an error as response to the
 // user. It's a convinience wrapper around clientError
-func (app *application) notFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound)
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusNotFound)
+}
+
+// serviceUnavailable() tells the user to retry later with a 503 status and a
+// Retry-After header (in seconds).
+func (app *application) serviceUnavailable(w http.ResponseWriter,
+	r *http.Request) {
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	app.clientError(w, r, http.StatusServiceUnavailable)
+}
+
+// Seconds sent with the Retry-After header when the DB is unavailable.
+const retryAfter = 30
+
+// dbUnavailable() returns true if err means no connexion could be acquired
+// from the pool: DB down, network error, connect timeout or pool closed
+// during shutdown.
+func dbUnavailable(err error) bool {
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &netErr):
+		return true
+	case pgconn.Timeout(err):
+		return true
+	case errors.Is(err, puddle.ErrClosedPool):
+		return true
+	}
+
+	return false
 }
 
 // render() retrieves the appropriate template set from the cache based on the
 // page name (exemple: 'home.tmpl.html'). If no entry exists in the cache with
 // the provided name, then create a new error and call the serverError() helper
 // method.
-func (app *application) render(w http.ResponseWriter, status int, page string,
-	data *templateData) {
+// The page is first written to a buffer, so a template error sends a clean
+// error page instead of half a page.
+func (app *application) render(w http.ResponseWriter, r *http.Request,
+	status int, page string, data *templateData) {
+
+	cache, err := app.templates()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
-	ts, ok := app.templateCache[page]
+	ts, ok := cache[page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
 	buf := new(bytes.Buffer)
 
-	err := ts.ExecuteTemplate(w, "base", data)
+	err = ts.ExecuteTemplate(buf, "base", data)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
 	}
 
 	w.WriteHeader(status)
@@ -58,8 +128,126 @@ func (app *application) render(w http.ResponseWriter, status int, page string,
 	buf.WriteTo(w)
 }
 
+// templates() returns the template cache. When the ui files are read from
+// disk the templates are parsed again, so a change is seen without restarting
+// the app.
+func (app *application) templates() (map[string]*template.Template, error) {
+	if app.config.uiDir != "" {
+		return newTemplateCache(app.ui, app.assets)
+	}
+
+	return app.templateCache, nil
+}
+
 // newTemplateData() returns a pointer to templateData struct already
 // initialized.
 func (app *application) newTemplateData(r *http.Request) *templateData {
-	return &templateData{}
+	return &templateData{
+		User:       app.contextGetUser(r),
+		Version:    version,
+		LiveReload: app.liveReload != nil,
+	}
+}
+
+// envelope is used to wrap every JSON response of the API.
+// Exemple: {"info": {...}}
+type envelope map[string]any
+
+// writeJSON() encodes data to JSON and sends it with the status code and the
+// extra headers.
+func (app *application) writeJSON(w http.ResponseWriter, status int,
+	data envelope, headers http.Header) error {
+
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// readJSON() decodes the request body to dst. The body is limited to 1MB and
+// unknown fields are refused so a typo in a field name isn't ignored.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request,
+	dst any) error {
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return fmt.Errorf("body contains badly-formed JSON: %w", err)
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// requestLogger() returns the app logger with the request ID and the user
+// name, so every line logged while handling the request can be linked.
+func (app *application) requestLogger(r *http.Request) *slog.Logger {
+	name := "anonymous"
+	if user := app.contextGetUser(r); user != nil {
+		name = user.Name
+	}
+
+	return app.logger.With("request_id", middleware.GetReqID(r.Context()),
+		"user", name)
+}
+
+// fieldConflict holds a field that the user modified while someone else
+// modified it too. Mine is the user value, Theirs the one stored in DB.
+type fieldConflict struct {
+	Field  string
+	Label  string
+	Mine   string
+	Theirs string
+}
+
+// infoConflicts() compares the form submitted by the user with the current
+// info and returns every field that differs.
+func infoConflicts(form infoCreateForm, current *data.Info) []fieldConflict {
+	fields := []fieldConflict{
+		{"agent", "Agent", form.Agent, current.Agent},
+		{"material", "Matériel", form.Material, current.Material},
+		{"equipment", "Équipement", form.Equipment, current.Equipment},
+		{"detail", "Détail", form.Detail, current.Detail},
+		{"event", "Évènement", form.Event, current.Event},
+		{"priority", "Priorité", form.Priority, strconv.Itoa(current.Priority)},
+		{"oups", "OUPS", form.Oups, current.Oups},
+		{"ameps", "AMEPS", form.Ameps, current.Ameps},
+		{"brips", "BRIPS", form.Brips, current.Brips},
+		{"rte", "RTE", form.Rte, current.Rte},
+		{"ais", "AIS", form.Ais, current.Ais},
+		{"estimate", "Estimation", form.Estimate, current.Estimate},
+		{"target", "Échéance", form.Target, current.TargetDate()},
+		{"status", "Statut", form.Status, current.Status},
+		{"doneby", "Fait par", form.Doneby, current.Doneby},
+	}
+
+	conflicts := []fieldConflict{}
+
+	for _, f := range fields {
+		if f.Mine != f.Theirs {
+			conflicts = append(conflicts, f)
+		}
+	}
+
+	return conflicts
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"e-curatif/internal/data"
+)
+
+// archiveJob() runs the archiving policy every archive.interval until ctx is
+// done. Resolved infos older than the source (or global) delay are set to
+// "archivé".
+func (app *application) archiveJob(ctx context.Context) {
+	if app.config.archive.interval <= 0 {
+		app.logger.Info("archiving job disabled")
+		return
+	}
+
+	ticker := time.NewTicker(app.config.archive.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.archive(ctx)
+		}
+	}
+}
+
+// archive() is a single run of the archiving job. Errors are only logged, the
+// job will try again on the next tick.
+func (app *application) archive(ctx context.Context) {
+	infos, err := app.infos.ArchiveResolved(ctx, app.config.archive.after)
+	if err != nil {
+		app.logger.Error("archiving job failed", "error", err)
+		return
+	}
+
+	app.logArchived(app.logger, "scheduled", infos)
+}
+
+// logArchived() logs what has been archived by a run. The same data is kept
+// in the history table.
+func (app *application) logArchived(logger *slog.Logger, run string,
+	infos []*data.Info) {
+
+	logger.Info("infos archived", "run", run, "count", len(infos))
+
+	for _, i := range infos {
+		logger.Info("info archived", "run", run, "info_id", i.ID,
+			"source_id", i.SourceID, "material", i.Material)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// liveReload tells the browser to reload the page when a file of the ui
+// directory changes. Only used when the files are read from disk (-ui-dir).
+//
+// The page opens an event stream on /dev/reload (see js/livereload.js), the
+// directory is checked every pollInterval and a "reload" event is sent as
+// soon as a file is newer than when the stream was opened.
+type liveReload struct {
+	fsys fs.FS
+
+	// Closed on shutdown so the open streams don't hold the server.
+	done chan struct{}
+	once sync.Once
+}
+
+const pollInterval = 500 * time.Millisecond
+
+func newLiveReload(fsys fs.FS) *liveReload {
+	return &liveReload{fsys: fsys, done: make(chan struct{})}
+}
+
+// stop() ends every open stream.
+func (lr *liveReload) stop() {
+	lr.once.Do(func() { close(lr.done) })
+}
+
+func (lr *liveReload) serve(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	// The stream stays open longer than the server WriteTimeout.
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	last := lr.lastModified()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-lr.done:
+			return
+		case <-ticker.C:
+			if mod := lr.lastModified(); mod.After(last) {
+				fmt.Fprint(w, "event: reload\ndata: \n\n")
+				rc.Flush()
+				return
+			}
+		}
+	}
+}
+
+// lastModified() returns the modification time of the newest file.
+func (lr *liveReload) lastModified() time.Time {
+	var last time.Time
+
+	fs.WalkDir(lr.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+
+		return nil
+	})
+
+	return last
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"e-curatif/internal/metrics"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// appMetrics holds the metrics updated by the app. The other ones (pool
+// stats, open curatifs) are read at each scrape by collect functions.
+type appMetrics struct {
+	registry *metrics.Registry
+
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	imports  *metrics.CounterVec
+	emails   *metrics.CounterVec
+	webhooks *metrics.CounterVec
+	gmao     *metrics.CounterVec
+}
+
+// newMetrics() registers every metric exposed on /metrics.
+func (app *application) newMetrics() *appMetrics {
+	reg := metrics.NewRegistry()
+
+	m := &appMetrics{
+		registry: reg,
+		requests: reg.Counter("ecuratif_http_requests_total",
+			"Number of HTTP requests per route pattern.",
+			"method", "route", "status"),
+		duration: reg.Histogram("ecuratif_http_request_duration_seconds",
+			"HTTP request latency per route pattern.", nil,
+			"method", "route"),
+		imports: reg.Counter("ecuratif_import_jobs_total",
+			"Number of CSV imports per outcome.", "outcome"),
+		emails: reg.Counter("ecuratif_emails_total",
+			"Number of emails sent per outcome.", "outcome"),
+		webhooks: reg.Counter("ecuratif_webhook_deliveries_total",
+			"Number of webhook calls per outcome.", "outcome"),
+		gmao: reg.Counter("ecuratif_gmao_sync_total",
+			"Number of GMAO synchronization operations per outcome.", "outcome"),
+	}
+
+	reg.Collect(app.collectPool)
+	reg.Collect(app.collectOpenInfos)
+
+	return m
+}
+
+// collectPool() exports the pgxpool stats.
+func (app *application) collectPool(w *metrics.Writer) {
+	stat := app.DB.Stat()
+
+	gauges := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"ecuratif_db_conns_acquired", "Connections currently acquired from the pool.", float64(stat.AcquiredConns())},
+		{"ecuratif_db_conns_idle", "Idle connections in the pool.", float64(stat.IdleConns())},
+		{"ecuratif_db_conns_total", "Total connections in the pool.", float64(stat.TotalConns())},
+		{"ecuratif_db_conns_max", "Max connections of the pool.", float64(stat.MaxConns())},
+	}
+
+	for _, g := range gauges {
+		w.Header(g.name, g.help, "gauge")
+		w.Sample(g.name, nil, g.value)
+	}
+
+	w.Header("ecuratif_db_acquire_total", "Number of connections acquired from the pool.", "counter")
+	w.Sample("ecuratif_db_acquire_total", nil, float64(stat.AcquireCount()))
+
+	w.Header("ecuratif_db_acquire_empty_total", "Number of acquires that had to wait for a connection.", "counter")
+	w.Sample("ecuratif_db_acquire_empty_total", nil, float64(stat.EmptyAcquireCount()))
+
+	w.Header("ecuratif_db_acquire_wait_seconds_total", "Total time spent waiting for a connection.", "counter")
+	w.Sample("ecuratif_db_acquire_wait_seconds_total", nil, stat.AcquireDuration().Seconds())
+}
+
+// collectOpenInfos() exports the number of open curatifs per source and
+// priority. Errors are logged and the metric is skipped for this scrape.
+func (app *application) collectOpenInfos(w *metrics.Writer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	counts, err := app.infos.OpenCounts(ctx)
+	if err != nil {
+		app.logger.Error("metrics: couldn't count open infos", "error", err)
+		return
+	}
+
+	name := "ecuratif_open_curatifs"
+
+	w.Header(name, "Open curatifs (not résolu nor archivé) per source and priority.", "gauge")
+
+	for _, c := range counts {
+		labels := []string{"source", c.Source, "priority", strconv.Itoa(c.Priority)}
+		w.Sample(name, labels, float64(c.Count))
+	}
+}
+
+// metricsHandler() sends every metric in the Prometheus text format.
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	_, err := app.metrics.registry.WriteTo(w)
+	if err != nil {
+		app.logger.Error("metrics: couldn't write metrics", "error", err)
+	}
+}
+
+// instrument() is a middleware counting the requests and their latency per
+// route pattern (/source/view/{id}), not per URL, so the number of series
+// stays small.
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		// The pattern is only known once chi routed the request.
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		app.metrics.requests.Inc(r.Method, route, strconv.Itoa(status))
+		app.metrics.duration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"e-curatif/internal/data"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// secureHeaders() sets the security headers of every response. HSTS is only
+// sent in production, the only env served over HTTPS.
+func (app *application) secureHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "deny")
+
+		if app.config.isProduction() {
+			w.Header().Set("Strict-Transport-Security",
+				"max-age=63072000; includeSubDomains")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate() reads the user name from config.authHeader. The header must
+// be set by the reverse proxy doing the authentication (and removed from
+// the client requests), the app doesn't check any password.
+// A user seen for the first time is added to the users table, and its team
+// (config.teamHeader) is updated when it changes. Without the header the
+// request is anonymous.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSpace(r.Header.Get(app.config.authHeader))
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.users.GetByName(r.Context(), name)
+		if errors.Is(err, data.ErrNoRows) {
+			user = &data.User{Name: name}
+			_, err = app.users.Insert(r.Context(), user)
+
+			// Another request created it in the meantime.
+			if errors.Is(err, data.ErrDuplicate) {
+				user, err = app.users.GetByName(r.Context(), name)
+			}
+		}
+
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		// The team is only known from the proxy, keep it up to date.
+		team := strings.TrimSpace(r.Header.Get(app.config.teamHeader))
+		if team != "" && team != user.Team {
+			err = app.users.SetTeam(r.Context(), user.ID, team)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			user.Team = team
+		}
+
+		next.ServeHTTP(w, app.contextSetUser(r, user))
+	})
+}
+
+// requireUser() refuses the anonymous requests with a 401 status.
+func (app *application) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetUser(r) == nil {
+			app.clientError(w, r, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logRequest() logs every request once it's done with its route pattern,
+// status and latency. The request ID is sent back with X-Request-Id.
+// It must come after authenticate() so the user is known.
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		ww.Header().Set("X-Request-Id", middleware.GetReqID(r.Context()))
+
+		next.ServeHTTP(ww, r)
+
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+
+		app.requestLogger(r).Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"latency", time.Since(start),
+			"remote", r.RemoteAddr)
+	})
+}
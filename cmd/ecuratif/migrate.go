@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"e-curatif/internal/migrate"
+)
+
+// runMigrate() handles the "migrate" command:
+//
+//	ecuratif -db-dsn=... migrate up      apply every pending migration
+//	ecuratif -db-dsn=... migrate down    roll back the last migration
+//	ecuratif -db-dsn=... migrate status  list migrations and their state
+func runMigrate(m *migrate.Migrator, args []string) error {
+	ctx := context.Background()
+
+	if len(args) != 1 {
+		return errors.New("usage: ecuratif migrate up|down|status")
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+
+		m.Logger.Info("migrations applied", "count", n)
+
+	case "down":
+		mig, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+
+		m.Logger.Info("migration rolled back", "version", mig.Version,
+			"name", mig.Name)
+
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+
+		for _, s := range status {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = s.Applied.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Fprintf(tw, "%06d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q (up|down|status)", args[0])
+	}
+
+	return nil
+}
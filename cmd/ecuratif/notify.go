@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"time"
+
+	"e-curatif/internal/data"
+	"e-curatif/internal/mailer"
+)
+
+// notification is passed to the templates of the mailer.
+type notification struct {
+	User           *data.User
+	Info           *data.Info
+	Source         string
+	URL            string
+	PreferencesURL string
+}
+
+// Number of emails sent by each run of the mail worker.
+const mailBatchSize = 50
+
+// notifyInfo() queues the emails due to the change of an info, before being
+// nil for a new info:
+//
+//   - the agent gets an email when the info is assigned to them ("affecté"
+//     with a target), or when the agent of an assigned info changes.
+//   - the planners get an email when it's resolved.
+//
+// Errors are only logged: the change itself succeeded.
+func (app *application) notifyInfo(ctx context.Context, logger *slog.Logger,
+	before, after *data.Info) {
+
+	if !app.emailsEnabled() {
+		return
+	}
+
+	var err error
+
+	switch {
+	case assigned(before, after):
+		err = app.notifyAgent(ctx, after)
+	case resolved(before, after):
+		err = app.notifySubscribers(ctx, data.NotifyResolved, after)
+	}
+
+	if err != nil {
+		logger.Error("could not queue the info emails", "info_id", after.ID,
+			"error", err)
+	}
+}
+
+func assigned(before, after *data.Info) bool {
+	if after.Status != "affecté" || after.Target == nil {
+		return false
+	}
+
+	return before == nil || before.Status != "affecté" ||
+		before.Target == nil || !strings.EqualFold(before.Agent, after.Agent)
+}
+
+func resolved(before, after *data.Info) bool {
+	return after.Status == "résolu" &&
+		(before == nil || before.Status != "résolu")
+}
+
+// notifyAgent() emails the user named like the agent of the info, if they
+// want it. The agent is free text, so there may be no such user.
+func (app *application) notifyAgent(ctx context.Context, info *data.Info) error {
+	u, err := app.users.GetByName(ctx, info.Agent)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRows) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !u.Wants(data.NotifyAssigned) {
+		return nil
+	}
+
+	return app.queueEmail(ctx, data.NotifyAssigned, u, info)
+}
+
+// notifySubscribers() emails every user wanting n about the info.
+func (app *application) notifySubscribers(ctx context.Context,
+	n data.Notification, info *data.Info) error {
+
+	users, err := app.users.Subscribers(ctx, n)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		err = app.queueEmail(ctx, n, u, info)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queueEmail() renders the email n for the user and puts it in the outbox,
+// the mail worker sends it.
+func (app *application) queueEmail(ctx context.Context, n data.Notification,
+	u *data.User, info *data.Info) error {
+
+	src, err := app.sources.Data(ctx, info.SourceID)
+	if err != nil {
+		return err
+	}
+
+	// A resolved info has no page anymore, the link goes to its source.
+	url := fmt.Sprintf("%s/source/%d/info/view/%d", app.config.baseURL,
+		info.SourceID, info.ID)
+	if n == data.NotifyResolved {
+		url = fmt.Sprintf("%s/source/view/%d", app.config.baseURL,
+			info.SourceID)
+	}
+
+	msg, err := mailer.Render(string(n)+".tmpl", notification{
+		User:           u,
+		Info:           info,
+		Source:         src.Name,
+		URL:            url,
+		PreferencesURL: app.config.baseURL + "/account/notifications",
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = app.outbox.Insert(ctx, &data.Email{
+		Recipient: (&mail.Address{Name: u.Name, Address: u.Email}).String(),
+		Subject:   msg.Subject,
+		Text:      msg.Text,
+		HTML:      msg.HTML,
+		Kind:      string(n),
+	})
+
+	return err
+}
+
+func (app *application) emailsEnabled() bool {
+	return app.config.smtp.interval > 0
+}
+
+// mailJob() sends the pending emails every smtp.interval until ctx is done.
+func (app *application) mailJob(ctx context.Context) {
+	if !app.emailsEnabled() {
+		app.logger.Info("emails disabled")
+		return
+	}
+
+	ticker := time.NewTicker(app.config.smtp.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.sendPending(ctx)
+		}
+	}
+}
+
+// sendPending() is a single run of the mail worker. A failed email is tried
+// again later, see retryDelay().
+func (app *application) sendPending(ctx context.Context) {
+	emails, err := app.outbox.Pending(ctx, app.config.smtp.maxAttempts,
+		mailBatchSize)
+	if err != nil {
+		app.logger.Error("could not read the outbox", "error", err)
+		return
+	}
+
+	for _, e := range emails {
+		err := app.mailer.Send(e.Recipient, &mailer.Message{
+			Subject: e.Subject,
+			Text:    e.Text,
+			HTML:    e.HTML,
+		})
+
+		if err == nil {
+			app.metrics.emails.Inc("sent")
+			err = app.outbox.MarkSent(ctx, e.ID)
+		} else {
+			attempts := e.Attempts + 1
+
+			app.metrics.emails.Inc("failed")
+			app.logger.Warn("email not sent", "email_id", e.ID,
+				"kind", e.Kind, "attempts", attempts, "error", err)
+
+			if attempts >= app.config.smtp.maxAttempts {
+				app.logger.Error("email given up", "email_id", e.ID,
+					"kind", e.Kind)
+			}
+
+			err = app.outbox.MarkFailed(ctx, e.ID, err,
+				time.Now().Add(retryDelay(attempts)))
+		}
+
+		if err != nil {
+			app.logger.Error("could not update the outbox", "email_id", e.ID,
+				"error", err)
+		}
+	}
+}
+
+// retryDelay() is the time to wait before trying again an email or a webhook
+// delivery which failed attempts times: 1, 4, 9, 16... minutes.
+func retryDelay(attempts int) time.Duration {
+	return time.Duration(attempts*attempts) * time.Minute
+}
+
+// overdueJob() emails the planners about the infos whose target just passed,
+// every smtp.overdueInterval until ctx is done.
+func (app *application) overdueJob(ctx context.Context) {
+	if !app.emailsEnabled() {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.smtp.overdueInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.notifyOverdue(ctx)
+		}
+	}
+}
+
+// notifyOverdue() is a single run of overdueJob().
+func (app *application) notifyOverdue(ctx context.Context) {
+	infos, err := app.infos.MarkOverdue(ctx)
+	if err != nil {
+		app.logger.Error("could not read the overdue infos", "error", err)
+		return
+	}
+
+	for _, i := range infos {
+		err := app.notifySubscribers(ctx, data.NotifyOverdue, i)
+		if err != nil {
+			app.logger.Error("could not queue the overdue emails",
+				"info_id", i.ID, "error", err)
+		}
+	}
+
+	if len(infos) > 0 {
+		app.logger.Info("overdue infos notified", "count", len(infos))
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"e-curatif/internal/data"
+	"e-curatif/internal/mailer"
+)
+
+// smtpSink is an in-process SMTP server, like cmd/smtpsink. The first
+// failures recipients are refused with a temporary error.
+type smtpSink struct {
+	l net.Listener
+
+	mu       sync.Mutex
+	failures int
+	messages []string
+}
+
+func newSMTPSink(t *testing.T, failures int) *smtpSink {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &smtpSink{l: l, failures: failures}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+// mailer() returns a Mailer sending to the sink.
+func (s *smtpSink) mailer() *mailer.Mailer {
+	addr := s.l.Addr().(*net.TCPAddr)
+
+	return mailer.New(addr.IP.String(), addr.Port, "", "",
+		"E-Curatif <no-reply@e-curatif.local>")
+}
+
+func (s *smtpSink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.messages...)
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		fmt.Fprintf(conn, "%s\r\n", line)
+	}
+
+	reply("220 sink ready")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		verb, _, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250 sink")
+		case "RCPT":
+			s.mu.Lock()
+			refused := s.failures > 0
+			s.failures--
+			s.mu.Unlock()
+
+			if refused {
+				reply("451 Try again later")
+			} else {
+				reply("250 OK")
+			}
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+
+			var b strings.Builder
+
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				if line == ".\r\n" {
+					break
+				}
+
+				b.WriteString(line)
+			}
+
+			s.mu.Lock()
+			s.messages = append(s.messages, b.String())
+			s.mu.Unlock()
+
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// The From and To headers are written by net/mail: the names are encoded and
+// an address which doesn't parse isn't sent.
+func TestMailHeaders(t *testing.T) {
+	name := (&mail.Address{Name: "Dupont, Élodie",
+		Address: "edupont@exemple.fr"}).String()
+
+	tests := []struct {
+		recipient string
+		wantTo    string // "" if refused
+	}{
+		{"dupont@exemple.fr", "To: <dupont@exemple.fr>"},
+		{"Dupont <dupont@exemple.fr>", `To: "Dupont" <dupont@exemple.fr>`},
+		{name, "To: " + name},
+		{"Dupont <dupont@exemple.fr>\r\nBcc: pirate@exemple.fr", ""},
+		{"dupont@exemple.fr\nBcc: pirate@exemple.fr", ""},
+		{"Dupont <dupont>", ""},
+	}
+
+	for _, tt := range tests {
+		sink := newSMTPSink(t, 0)
+
+		err := sink.mailer().Send(tt.recipient, &mailer.Message{
+			Subject: "Curatif", Text: "Bonjour", HTML: "<p>Bonjour</p>"})
+
+		messages := sink.received()
+
+		if tt.wantTo == "" {
+			if err == nil || len(messages) != 0 {
+				t.Errorf("%q: got %d emails (%v), want refused", tt.recipient,
+					len(messages), err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", tt.recipient, err)
+			continue
+		}
+
+		if len(messages) != 1 {
+			t.Fatalf("%q: got %d emails, want 1", tt.recipient, len(messages))
+		}
+
+		if !strings.Contains(messages[0], tt.wantTo+"\r\n") ||
+			!strings.Contains(messages[0],
+				`From: "E-Curatif" <no-reply@e-curatif.local>`+"\r\n") {
+			t.Errorf("%q: got\n%s", tt.recipient, messages[0])
+		}
+	}
+}
+
+// recordingOutbox records the calls of the mail worker. A failed email is
+// due again at once, as if its retry delay was over.
+type recordingOutbox struct {
+	data.OutboxRepository
+
+	mu     sync.Mutex
+	sent   []int
+	failed []failedEmail
+}
+
+type failedEmail struct {
+	id    int
+	err   error
+	delay time.Duration
+}
+
+func (o *recordingOutbox) MarkSent(ctx context.Context, id int) error {
+	o.mu.Lock()
+	o.sent = append(o.sent, id)
+	o.mu.Unlock()
+
+	return o.OutboxRepository.MarkSent(ctx, id)
+}
+
+func (o *recordingOutbox) MarkFailed(ctx context.Context, id int, sendErr error,
+	next time.Time) error {
+
+	o.mu.Lock()
+	o.failed = append(o.failed, failedEmail{id, sendErr, time.Until(next)})
+	o.mu.Unlock()
+
+	return o.OutboxRepository.MarkFailed(ctx, id, sendErr, time.Now())
+}
+
+func newMailTest(t *testing.T, failures, maxAttempts int) (*application,
+	*smtpSink, *recordingOutbox) {
+
+	t.Helper()
+
+	app, models := newTestApplication(t)
+	sink := newSMTPSink(t, failures)
+	outbox := &recordingOutbox{OutboxRepository: models.Outbox}
+
+	app.mailer = sink.mailer()
+	app.outbox = outbox
+	app.config.smtp.maxAttempts = maxAttempts
+
+	return app, sink, outbox
+}
+
+func queueTestEmail(t *testing.T, app *application, subject string) int {
+	t.Helper()
+
+	id, err := app.outbox.Insert(context.Background(), &data.Email{
+		Recipient: "Dupont <dupont@exemple.fr>",
+		Subject:   subject,
+		Text:      "Bonjour",
+		HTML:      "<p>Bonjour</p>",
+		Kind:      string(data.NotifyAssigned),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// The worker started by mailJob() delivers the queued emails.
+func TestMailJob(t *testing.T) {
+	app, sink, outbox := newMailTest(t, 0, 5)
+	app.config.smtp.interval = 10 * time.Millisecond
+
+	first := queueTestEmail(t, app, "Curatif 1")
+	second := queueTestEmail(t, app, "Curatif 2")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		app.mailJob(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.received()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	messages := sink.received()
+	if len(messages) != 2 {
+		t.Fatalf("got %d emails, want 2", len(messages))
+	}
+
+	for n, subject := range []string{"Curatif 1", "Curatif 2"} {
+		if !strings.Contains(messages[n], "Subject: "+subject) ||
+			!strings.Contains(messages[n], "dupont@exemple.fr") {
+			t.Errorf("email %d: got\n%s", n, messages[n])
+		}
+	}
+
+	if fmt.Sprint(outbox.sent) != fmt.Sprint([]int{first, second}) {
+		t.Errorf("got sent %v, want [%d %d]", outbox.sent, first, second)
+	}
+
+	if len(outbox.failed) != 0 {
+		t.Errorf("got %d failures", len(outbox.failed))
+	}
+
+	// Nothing is sent twice.
+	app.sendPending(context.Background())
+
+	if n := len(sink.received()); n != 2 {
+		t.Errorf("got %d emails after another run, want 2", n)
+	}
+}
+
+// A refused email is tried again after 1, 4, 9... minutes, until
+// smtp.maxAttempts.
+func TestSendPendingRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		maxAttempts int
+		runs        int
+		wantFailed  int
+		wantSent    bool
+	}{
+		{"sent at once", 0, 3, 1, 0, true},
+		{"sent after two failures", 2, 3, 3, 2, true},
+		{"given up", 10, 3, 5, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, sink, outbox := newMailTest(t, tt.failures, tt.maxAttempts)
+
+			id := queueTestEmail(t, app, "Curatif")
+
+			for n := 0; n < tt.runs; n++ {
+				app.sendPending(context.Background())
+			}
+
+			if len(outbox.failed) != tt.wantFailed {
+				t.Fatalf("got %d failures, want %d", len(outbox.failed),
+					tt.wantFailed)
+			}
+
+			for n, f := range outbox.failed {
+				want := retryDelay(n + 1)
+
+				if f.id != id || f.err == nil {
+					t.Errorf("failure %d: got email %d (%v)", n, f.id, f.err)
+				}
+
+				if f.delay > want || f.delay < want-time.Second {
+					t.Errorf("failure %d: got delay %s, want %s", n, f.delay,
+						want)
+				}
+			}
+
+			wantSent := []int{}
+			if tt.wantSent {
+				wantSent = []int{id}
+			}
+
+			if fmt.Sprint(outbox.sent) != fmt.Sprint(wantSent) {
+				t.Errorf("got sent %v, want %v", outbox.sent, wantSent)
+			}
+
+			if n := len(sink.received()); n != len(wantSent) {
+				t.Errorf("got %d emails delivered, want %d", n, len(wantSent))
+			}
+
+			pending, err := app.outbox.Pending(context.Background(),
+				tt.maxAttempts, mailBatchSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(pending) != 0 {
+				t.Errorf("got %d emails still pending", len(pending))
+			}
+		})
+	}
+}
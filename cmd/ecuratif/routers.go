@@ -9,7 +9,27 @@ import (
 
 func (app *application) routes() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.NotFound(app.notFoundHandler)
+	r.MethodNotAllowed(app.methodNotAllowedHandler)
+
+	r.Use(middleware.RequestID)
+	r.Use(app.secureHeaders)
+	r.Use(app.authenticate)
+	r.Use(app.logRequest)
+	r.Use(app.instrument)
+
+	// Supervisor
+	r.Get("/healthz", app.healthz)
+	r.Get("/readyz", app.readyz)
+	r.Get("/version", app.versionInfo)
+	r.Get("/metrics", app.metricsHandler)
+
+	// Static files, see assets.go
+	r.Get("/static/*", app.assets.serve)
+
+	if app.liveReload != nil {
+		r.Get("/dev/reload", app.liveReload.serve)
+	}
 
 	// Home Page
 	r.Get("/", app.home)
@@ -21,6 +41,8 @@ func (app *application) routes() http.Handler {
 	r.Post("/source/delete/{id}", app.sourceDeletePost)
 	r.Get("/source/update/{id}", app.sourceUpdate)
 	r.Post("/source/update/{id}", app.sourceUpdatePost)
+	r.Post("/source/archive/{id}", app.sourceArchivePost)
+	r.Post("/archive", app.archivePost)
 
 	// Info Pages
 	r.Get("/source/{sid}/info/view/{id}", app.infoView)
@@ -30,5 +52,58 @@ func (app *application) routes() http.Handler {
 	r.Get("/source/{sid}/info/update/{id}", app.infoUpdate)
 	r.Post("/source/{sid}/info/update/{id}", app.infoUpdatePost)
 
+	// Equipment catalogue
+	r.Get("/source/{id}/equipment", app.equipmentList)
+	r.Post("/source/{id}/equipment", app.equipmentCreatePost)
+	r.Get("/equipment/{id}", app.equipmentView)
+	r.Post("/equipment/{id}", app.equipmentUpdatePost)
+	r.Post("/equipment/{id}/delete", app.equipmentDeletePost)
+
+	// Saved views, preferences and webhooks, only for the identified users
+	r.Group(func(r chi.Router) {
+		r.Use(app.requireUser)
+
+		r.Get("/views", app.viewList)
+		r.Get("/views/create", app.viewCreate)
+		r.Post("/views/create", app.viewCreatePost)
+		r.Get("/views/{id}", app.viewOpen)
+		r.Post("/views/{id}/update", app.viewUpdatePost)
+		r.Post("/views/{id}/delete", app.viewDeletePost)
+
+		r.Get("/account/notifications", app.accountNotifications)
+		r.Post("/account/notifications", app.accountNotificationsPost)
+
+		r.Get("/webhooks", app.webhookList)
+		r.Post("/webhooks", app.webhookCreatePost)
+		r.Get("/webhooks/{id}", app.webhookView)
+		r.Post("/webhooks/{id}", app.webhookUpdatePost)
+		r.Post("/webhooks/{id}/delete", app.webhookDeletePost)
+		r.Post("/webhooks/deliveries/{id}/redeliver", app.webhookRedeliverPost)
+	})
+
+	// SLA rules and report
+	r.Get("/sla", app.slaList)
+	r.Post("/sla", app.slaSetPost)
+	r.Post("/sla/{id}/delete", app.slaDeletePost)
+	r.Get("/sla/report", app.slaReportView)
+
+	// Recurring defects report
+	r.Get("/recurring", app.recurringView)
+
+	// Search
+	r.Get("/search", app.search)
+
+	// CSV import
+	r.Get("/import", app.importCSV)
+	r.Post("/import", app.importCSVPost)
+
+	// API
+	r.Get("/api/v1/info/{id}", app.infoShowAPI)
+	r.Put("/api/v1/info/{id}", app.infoUpdateAPI)
+	r.Get("/api/v1/search", app.searchAPI)
+	r.Get("/api/v1/source/{id}", app.sourceShowAPI)
+	r.Post("/api/v1/source", app.sourceCreateAPI)
+	r.Put("/api/v1/source/{id}", app.sourceUpdateAPI)
+
 	return r
 }
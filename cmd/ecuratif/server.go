@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve() starts the server and blocks until it's stopped.
+// On SIGINT or SIGTERM, the server stops accepting new requests and the
+// running ones have config.shutdownTimeout to finish. The background jobs are
+// then stopped and waited for within the same timeout.
+func (app *application) serve() error {
+	srv := &http.Server{
+		Addr:         app.config.port,
+		Handler:      app.routes(),
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	// The live reload streams never end by themselves.
+	if app.liveReload != nil {
+		srv.RegisterOnShutdown(app.liveReload.stop)
+	}
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(),
+			app.config.shutdownTimeout)
+		defer cancel()
+
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		app.logger.Info("stopping background jobs")
+
+		app.stopJobs()
+
+		done := make(chan struct{})
+
+		go func() {
+			app.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			shutdownError <- nil
+		case <-ctx.Done():
+			shutdownError <- errors.New("background jobs didn't stop in time")
+		}
+	}()
+
+	app.logger.Info("starting server", "addr", app.config.port)
+
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("server stopped")
+
+	return nil
+}
+
+// background() runs fn in its own goroutine with the jobs context. The
+// shutdown waits for fn to return, so fn must return once ctx is done.
+// A panic is logged instead of stopping the whole app.
+func (app *application) background(fn func(ctx context.Context)) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error("background job panic",
+					"error", fmt.Sprint(err))
+			}
+		}()
+
+		fn(app.jobsCtx)
+	}()
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"html/template"
-	"path/filepath"
+	"io/fs"
+	"path"
+	"strings"
 	"time"
 
 	"e-curatif/internal/data"
@@ -17,7 +19,51 @@ type templateData struct {
 	Info  *data.Info
 	Infos []*data.Info
 
+	// Pages of Infos.
+	Metadata data.Metadata
+
+	// Saved views, with their counts.
+	Views []*data.SavedView
+
+	// SLA rules and report.
+	SLAs   []*data.SLA
+	Report *slaReport
+
+	// Repeated defects per equipment or material.
+	Recurring *recurringReport
+
+	// Webhooks and the log of their deliveries, given up after
+	// MaxAttempts.
+	Webhooks    []*data.Webhook
+	Webhook     *data.Webhook
+	Deliveries  []*data.Delivery
+	MaxAttempts int
+
+	// Equipment of a source: its page, or the catalogue autocompleted by
+	// the info forms.
+	Equipment *data.Equipment
+	Catalogue []*data.Equipment
+
+	// User of the request, nil if anonymous.
+	User *data.User
+
 	Form any
+
+	// Search page results.
+	Results []*data.SearchResult
+
+	// Fields that differ between the user edit and the current info when
+	// an edit conflict happens.
+	Conflicts []fieldConflict
+
+	// Set by errorPage() for error.tmpl.html.
+	Error *errorData
+
+	// Shown in the footer.
+	Version string
+
+	// Adds the live reload script to the page (dev mode only).
+	LiveReload bool
 }
 
 // @ tables source and info, columns "Created" and "Updated" have
@@ -29,36 +75,90 @@ func humanDate(t time.Time) string {
 	return t.Format("02/01/2006")
 }
 
-// template.FuncMap() is initializa and stocked in a global variable. It
-// facilitates the use humanDate function.
-var functions = template.FuncMap{
-	"humanDate": humanDate,
+// humanMonth() is used by the SLA report, exemple: 05/2024.
+func humanMonth(t time.Time) string {
+	return t.Format("01/2006")
 }
 
-// newTemplateCache() uses filepath.Glob() function to get a slice of all
-// filepaths that match the path string.
-// Exemple: [./ui/html/base.tmpl.html ./ui/html/pages/index.tmpl.html ...]
-func newTemplateCache() (map[string]*template.Template, error) {
+// humanTime() is used by the logs, exemple: 05/02/2024 14:03:27.
+func humanTime(t time.Time) string {
+	return t.Format("02/01/2006 15:04:05")
+}
+
+// Values proposed by the info forms.
+var (
+	priorities = []int{1, 2, 3, 4}
+	statuses   = []string{"en attente", "affecté", "résolu"}
+)
+
+// formField is passed to the "infoField" template, which renders one input
+// with its label and its error.
+type formField struct {
+	Name  string
+	Label string
+	Value string
+	Error string
+}
+
+// field() builds a formField, errors being the FieldErrors of the form.
+// Exemple: {{template "infoField" (field .Form.FieldErrors "agent" "Agent" .Form.Agent)}}
+func field(errors map[string]string, name, label, value string) formField {
+	return formField{Name: name, Label: label, Value: value, Error: errors[name]}
+}
+
+// highlight() escapes the search headline and replaces the markers set by
+// the DB around the matching words with <mark> tags.
+func highlight(headline string) template.HTML {
+	s := template.HTMLEscapeString(headline)
+	s = strings.ReplaceAll(s, data.HighlightStart, "<mark>")
+	s = strings.ReplaceAll(s, data.HighlightStop, "</mark>")
+
+	return template.HTML(s)
+}
+
+// newTemplateCache() parses every page of html/pages in fsys with the base
+// template and the partials. fsys is ui.Files, or the ui directory on disk
+// in dev mode. assets gives the URL of the static files to the templates.
+func newTemplateCache(fsys fs.FS, assets *assets) (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
-	pages, err := filepath.Glob("./ui/html/pages/*.tmpl.html")
+	// template.FuncMap() facilitates the use of the helpers inside the
+	// templates. Exemple: {{humanDate .Created}}
+	functions := template.FuncMap{
+		"humanDate":       humanDate,
+		"humanMonth":      humanMonth,
+		"asset":           assets.url,
+		"field":           field,
+		"highlight":       highlight,
+		"add":             func(a, b int) int { return a + b },
+		"viewURL":         viewURL,
+		"priorities":      func() []int { return priorities },
+		"statuses":        func() []string { return statuses },
+		"searchStatuses":  func() []string { return searchStatuses },
+		"slaMonths":       func() []int { return slaMonths },
+		"recurringMonths": func() []int { return recurringMonths },
+		"webhookEvents":   func() []string { return data.WebhookEvents },
+		"humanTime":       humanTime,
+	}
+
+	pages, err := fs.Glob(fsys, "html/pages/*.tmpl.html")
 	if err != nil {
 		return nil, err
 	}
 
 	for _, page := range pages {
-		name := filepath.Base(page)
+		name := path.Base(page)
 
-		// Hardcoded path string below are added maually simply because
-		// they aren't inside ".../html/pages/*.tmpl.html"
-		files := []string{
-			"./ui/html/base.tmpl.html",
-			"./ui/html/partials/nav.tmpl.html",
+		// The base template and the partials come first, they are shared
+		// by every page.
+		patterns := []string{
+			"html/base.tmpl.html",
+			"html/partials/*.tmpl.html",
 			page,
 		}
 
 		// Parse the files into a template set.
-		ts, err := template.ParseFiles(files...)
+		ts, err := template.New(name).Funcs(functions).ParseFS(fsys, patterns...)
 		if err != nil {
 			return nil, err
 		}
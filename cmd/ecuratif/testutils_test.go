@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"e-curatif/internal/data"
+	"e-curatif/ui"
+)
+
+// newTestApplication() returns an application running on the in-memory
+// stores, with the embedded templates. The models are returned so a test can
+// prepare or check the data behind the handlers.
+func newTestApplication(t *testing.T) (*application, data.Models) {
+	t.Helper()
+
+	models := data.NewMemoryModels()
+
+	assets, err := newAssets(ui.Files, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templateCache, err := newTemplateCache(ui.Files, assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		sources:       models.Sources,
+		infos:         models.Infos,
+		users:         models.Users,
+		views:         models.Views,
+		slas:          models.SLAs,
+		outbox:        models.Outbox,
+		webhooks:      models.Webhooks,
+		equipment:     models.Equipment,
+		templateCache: templateCache,
+		ui:            ui.Files,
+		assets:        assets,
+	}
+
+	app.config.authHeader = "X-Remote-User"
+	app.config.teamHeader = "X-Remote-Group"
+
+	app.metrics = app.newMetrics()
+
+	return app, models
+}
+
+type testServer struct {
+	*httptest.Server
+}
+
+// newTestServer() serves h, the redirects aren't followed so their status
+// and location can be checked.
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testServer{ts}
+}
+
+// do() sends the request as user (anonymous if empty) and returns the
+// status, the headers and the body of the response.
+func (ts *testServer) do(t *testing.T, method, path, user, contentType,
+	body string) (int, http.Header, string) {
+
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user != "" {
+		req.Header.Set("X-Remote-User", user)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(b))
+}
+
+func (ts *testServer) get(t *testing.T, path string) (int, http.Header, string) {
+	t.Helper()
+
+	return ts.do(t, http.MethodGet, path, "", "", "")
+}
+
+func (ts *testServer) postForm(t *testing.T, path string,
+	form url.Values) (int, http.Header, string) {
+
+	t.Helper()
+
+	return ts.do(t, http.MethodPost, path, "",
+		"application/x-www-form-urlencoded", form.Encode())
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"e-curatif/internal/data"
+)
+
+// Number of deliveries sent by each run of the webhooks worker.
+const webhookBatchSize = 50
+
+// Headers of the webhook calls. The signature is the HMAC-SHA256 of the body
+// with the secret of the webhook, in hex: "sha256=8f2c...".
+const (
+	headerEvent     = "X-Ecuratif-Event"
+	headerDelivery  = "X-Ecuratif-Delivery"
+	headerSignature = "X-Ecuratif-Signature"
+)
+
+// webhookPayload is the JSON body of the webhook calls.
+type webhookPayload struct {
+	Event   string    `json:"event"`
+	Created time.Time `json:"created"`
+	Data    any       `json:"data"`
+}
+
+// webhookInfo adds the IDs, hidden from the API, to the info.
+// PreviousStatus is only set for info.status_changed.
+type webhookInfo struct {
+	ID             int    `json:"id"`
+	SourceID       int    `json:"source_id"`
+	PreviousStatus string `json:"previous_status,omitempty"`
+	*data.Info
+}
+
+// webhookSource adds the ID, hidden from the API, to the source.
+type webhookSource struct {
+	ID int `json:"id"`
+	*data.Source
+}
+
+func (app *application) webhooksEnabled() bool {
+	return app.config.webhook.interval > 0
+}
+
+// infoEvents() queues the webhook events due to the change of an info,
+// before being nil for a new info.
+func (app *application) infoEvents(ctx context.Context, logger *slog.Logger,
+	before, after *data.Info) {
+
+	payload := webhookInfo{ID: after.ID, SourceID: after.SourceID, Info: after}
+
+	if before == nil {
+		app.fireWebhooks(ctx, logger, data.EventInfoCreated, payload)
+		return
+	}
+
+	app.fireWebhooks(ctx, logger, data.EventInfoUpdated, payload)
+
+	if before.Status != after.Status {
+		payload.PreviousStatus = before.Status
+		app.fireWebhooks(ctx, logger, data.EventInfoStatusChanged, payload)
+	}
+}
+
+// sourceEvent() queues the webhook event of a source.
+func (app *application) sourceEvent(ctx context.Context, logger *slog.Logger,
+	event string, src *data.Source) {
+
+	app.fireWebhooks(ctx, logger, event, webhookSource{ID: src.ID, Source: src})
+}
+
+// fireWebhooks() queues a delivery of the event for each webhook wanting it,
+// the worker sends them. Errors are only logged: the change itself
+// succeeded.
+func (app *application) fireWebhooks(ctx context.Context, logger *slog.Logger,
+	event string, payload any) {
+
+	if !app.webhooksEnabled() {
+		return
+	}
+
+	hooks, err := app.webhooks.Subscribed(ctx, event)
+	if err != nil {
+		logger.Error("could not read the webhooks", "event", event,
+			"error", err)
+		return
+	}
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Event:   event,
+		Created: time.Now().UTC(),
+		Data:    payload,
+	})
+	if err != nil {
+		logger.Error("could not encode the webhook payload", "event", event,
+			"error", err)
+		return
+	}
+
+	for _, w := range hooks {
+		_, err := app.webhooks.Queue(ctx, &data.Delivery{
+			WebhookID: w.ID,
+			Event:     event,
+			Payload:   string(body),
+		})
+		if err != nil {
+			logger.Error("could not queue the webhook delivery",
+				"webhook_id", w.ID, "event", event, "error", err)
+		}
+	}
+}
+
+// webhookJob() sends the pending deliveries every webhook.interval until ctx
+// is done.
+func (app *application) webhookJob(ctx context.Context) {
+	if !app.webhooksEnabled() {
+		app.logger.Info("webhooks disabled")
+		return
+	}
+
+	client := &http.Client{Timeout: app.config.webhook.timeout}
+
+	ticker := time.NewTicker(app.config.webhook.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.sendWebhooks(ctx, client)
+		}
+	}
+}
+
+// sendWebhooks() is a single run of the webhooks worker. A delivery is done
+// when the webhook answers with a 2xx status, otherwise it's tried again
+// later, see retryDelay().
+func (app *application) sendWebhooks(ctx context.Context, client *http.Client) {
+	deliveries, err := app.webhooks.Pending(ctx,
+		app.config.webhook.maxAttempts, webhookBatchSize)
+	if err != nil {
+		app.logger.Error("could not read the webhook deliveries", "error", err)
+		return
+	}
+
+	for _, d := range deliveries {
+		status, err := deliver(ctx, client, d)
+
+		if err == nil {
+			app.metrics.webhooks.Inc("delivered")
+			err = app.webhooks.MarkDelivered(ctx, d.ID, status)
+		} else {
+			attempts := d.Attempts + 1
+
+			app.metrics.webhooks.Inc("failed")
+			app.logger.Warn("webhook not delivered", "delivery_id", d.ID,
+				"webhook_id", d.WebhookID, "event", d.Event,
+				"attempts", attempts, "error", err)
+
+			if attempts >= app.config.webhook.maxAttempts {
+				app.logger.Error("webhook delivery given up", "delivery_id",
+					d.ID, "webhook_id", d.WebhookID)
+			}
+
+			err = app.webhooks.MarkFailed(ctx, d.ID, status, err,
+				time.Now().Add(retryDelay(attempts)))
+		}
+
+		if err != nil {
+			app.logger.Error("could not update the webhook delivery",
+				"delivery_id", d.ID, "error", err)
+		}
+	}
+}
+
+// deliver() posts the signed payload of d. It returns the status received,
+// 0 if there's no response.
+func deliver(ctx context.Context, client *http.Client, d *data.Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL,
+		bytes.NewBufferString(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "E-Curatif-Webhook/"+version)
+	req.Header.Set(headerEvent, d.Event)
+	req.Header.Set(headerDelivery, fmt.Sprint(d.ID))
+	req.Header.Set(headerSignature, sign(d.Secret, d.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Read a bit of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// sign() returns the value of the signature header of the payload.
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookSecret() returns a random secret of 32 bytes, in hex.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
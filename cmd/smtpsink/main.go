@@ -0,0 +1,117 @@
+// smtpsink is a local SMTP stand-in for development: it accepts every
+// message and prints it on stdout, nothing is delivered. Run it with
+// "make mail/sink", the default -smtp-* flags of ecuratif point to it.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:1025", "Listening address")
+	flag.Parse()
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("smtpsink listening on %s", l.Addr())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+
+		go serve(conn)
+	}
+}
+
+// serve() speaks just enough SMTP for net/smtp: no TLS, no authentication.
+func serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(s string) {
+		fmt.Fprintf(conn, "%s\r\n", s)
+	}
+
+	reply("220 smtpsink ready")
+
+	var from string
+	var to []string
+
+	for {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250 smtpsink")
+		case "MAIL":
+			from, to = arg, nil
+			reply("250 OK")
+		case "RCPT":
+			to = append(to, arg)
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+
+			body, err := readData(r)
+			if err != nil {
+				return
+			}
+
+			fmt.Printf("===== %s %s -> %s\n%s\n",
+				time.Now().Format(time.DateTime), from,
+				strings.Join(to, ", "), body)
+			reply("250 OK")
+		case "RSET":
+			from, to = "", nil
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// readData() reads the message up to the line holding a single dot.
+func readData(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." {
+			return b.String(), nil
+		}
+
+		// Dot-stuffing, RFC 5321 4.5.2.
+		b.WriteString(strings.TrimPrefix(line, "."))
+		b.WriteString("\n")
+	}
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// ArchiveResolved() sets every info "résolu" since more than N days to
+// "archivé", N being the "archive_after" column of the source, or the days
+// parameter if it's NULL. N = 0 disables the archiving: days being 0 only
+// archives the sources having their own delay, and a source with 0 is never
+// archived. The age comes from the resolved date, so editing a resolved info
+// doesn't delay its archiving.
+// Every archived info is logged into the history table.
+func (s *InfoStore) ArchiveResolved(ctx context.Context, days int) ([]*Info, error) {
+	query := `
+WITH archived AS (
+UPDATE info AS i
+   SET status = 'archivé', updated = $2, version = version + 1
+  FROM source AS s
+ WHERE i.source_id = s.id AND
+       i.status = 'résolu' AND
+       COALESCE(s.archive_after, $1) > 0 AND
+       i.resolved < $2 - make_interval(days => COALESCE(s.archive_after, $1))
+RETURNING i.id, i.source_id, i.material
+)
+INSERT INTO history (info_id, source_id, action, detail, created)
+SELECT id, source_id, 'archivé', material, $2
+  FROM archived
+RETURNING info_id, source_id, detail
+`
+
+	return s.archive(ctx, query, days, time.Now().UTC())
+}
+
+// ArchiveSource() is the manual version of ArchiveResolved(). Every info
+// "résolu" of the source is archived right away, whatever its age.
+func (s *InfoStore) ArchiveSource(ctx context.Context, id int) ([]*Info, error) {
+	query := `
+WITH archived AS (
+UPDATE info
+   SET status = 'archivé', updated = $2, version = version + 1
+ WHERE source_id = $1 AND
+       status = 'résolu'
+RETURNING id, source_id, material
+)
+INSERT INTO history (info_id, source_id, action, detail, created)
+SELECT id, source_id, 'archivé', material, $2
+  FROM archived
+RETURNING info_id, source_id, detail
+`
+
+	return s.archive(ctx, query, id, time.Now().UTC())
+}
+
+// archive() runs one of the archiving queries above and returns the infos
+// that have been archived (id, source_id and material only).
+func (s *InfoStore) archive(ctx context.Context, query string, args ...any) ([]*Info, error) {
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infos := []*Info{}
+
+	for rows.Next() {
+		info := &Info{}
+
+		err := rows.Scan(&info.ID, &info.SourceID, &info.Material)
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, info)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// DigestPriority is the lowest priority whose overdue infos are listed in
+// the digests (P1 and P2).
+const DigestPriority = 2
+
+// Digest sums up the activity of a source during a period, for the digest
+// emails. Same counts as GetAllActive() and InfoSolved(), over the period.
+type Digest struct {
+	SourceID int    `json:"source_id"`
+	Source   string `json:"source"`
+
+	New      int `json:"new"`      // created during the period
+	Resolved int `json:"resolved"` // resolved during the period
+	Open     int `json:"open"`     // still open now
+
+	// Open infos of priority DigestPriority or more whose target is past,
+	// the oldest target first. NbOverdue counts them all, Overdue only
+	// holds the first ones.
+	NbOverdue int     `json:"nb_overdue"`
+	Overdue   []*Info `json:"overdue"`
+
+	// Oldest open infos, the oldest first.
+	Oldest []*Info `json:"oldest"`
+}
+
+// Empty() is true when there's nothing to tell about the source.
+func (d *Digest) Empty() bool {
+	return d.New == 0 && d.Resolved == 0 && d.Open == 0
+}
+
+// Digest() returns the Digest of every source for the period [from, to),
+// ordered by name. Overdue and Oldest hold at most limit infos each.
+func (s *SourceStore) Digest(ctx context.Context, from, to time.Time,
+	limit int) ([]*Digest, error) {
+
+	query := `
+SELECT s.id,
+       s.name,
+       COUNT(i.id) FILTER (WHERE i.created >= $1 AND i.created < $2),
+       COUNT(i.id) FILTER (WHERE i.resolved >= $1 AND i.resolved < $2),
+       COUNT(i.id) FILTER (WHERE i.status NOT IN ('résolu', 'archivé')),
+       COUNT(i.id) FILTER (WHERE i.status NOT IN ('résolu', 'archivé') AND
+                                 i.priority <= $3 AND
+                                 i.target < $4::date)
+  FROM source AS s
+       LEFT JOIN info AS i
+       ON i.source_id = s.id
+ GROUP BY s.id
+ ORDER BY s.name ASC
+`
+
+	rows, err := s.DB.Query(ctx, query, from.UTC(), to.UTC(), DigestPriority,
+		today(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	digests := []*Digest{}
+	bySource := map[int]*Digest{}
+
+	for rows.Next() {
+		d := &Digest{Overdue: []*Info{}, Oldest: []*Info{}}
+
+		scan := []any{&d.SourceID, &d.Source, &d.New, &d.Resolved, &d.Open,
+			&d.NbOverdue}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		digests = append(digests, d)
+		bySource[d.SourceID] = d
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Both lists in one query, numbered per source.
+	query = `
+SELECT list, id, source_id, agent, material, priority, status, target,
+       created
+  FROM (SELECT 'overdue' AS list, id, source_id, agent, material, priority,
+               status, target, created,
+               row_number() OVER (PARTITION BY source_id
+                                  ORDER BY target, created) AS n
+          FROM info
+         WHERE status NOT IN ('résolu', 'archivé') AND
+               priority <= $2 AND
+               target < $3::date
+         UNION ALL
+        SELECT 'oldest', id, source_id, agent, material, priority, status,
+               target, created,
+               row_number() OVER (PARTITION BY source_id
+                                  ORDER BY created, id)
+          FROM info
+         WHERE status NOT IN ('résolu', 'archivé')) AS l
+ WHERE n <= $1
+ ORDER BY source_id, list, n
+`
+
+	rows, err = s.DB.Query(ctx, query, limit, DigestPriority, today(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var list string
+
+		i := &Info{}
+
+		scan := []any{&list, &i.ID, &i.SourceID, &i.Agent, &i.Material,
+			&i.Priority, &i.Status, &i.Target, &i.Created}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		d, ok := bySource[i.SourceID]
+		if !ok {
+			continue
+		}
+
+		if list == "overdue" {
+			d.Overdue = append(d.Overdue, i)
+		} else {
+			d.Oldest = append(d.Oldest, i)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return digests, nil
+}
@@ -0,0 +1,254 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Equipment is an item of the catalogue of a source. Its name is unique in
+// the source whatever the case, it's what the curatif form autocompletes.
+type Equipment struct {
+	ID           int        `json:"id"`
+	SourceID     int        `json:"-"`
+	Name         string     `json:"name"`
+	Bay          string     `json:"bay,omitempty"`
+	Type         string     `json:"type,omitempty"`
+	Manufacturer string     `json:"manufacturer,omitempty"`
+	Serial       string     `json:"serial,omitempty"`
+	Commissioned *time.Time `json:"commissioned,omitempty"`
+
+	// Set by List(): every curatif of the equipment, and the open ones.
+	NbCuratifs int `json:"-"`
+	NbOpen     int `json:"-"`
+
+	Created time.Time `json:"-"`
+}
+
+// CommissionedDate() returns the commissioning date in DateLayout, "" if
+// it's unknown.
+func (e *Equipment) CommissionedDate() string {
+	if e.Commissioned == nil {
+		return ""
+	}
+
+	return e.Commissioned.Format(DateLayout)
+}
+
+// EquipmentStore makes the connexion between the handlers and the equipment
+// table.
+type EquipmentStore struct {
+	DB *pgxpool.Pool
+}
+
+const equipmentColumns = `
+SELECT id, source_id, name, bay, type, manufacturer, serial, commissioned,
+       created
+  FROM equipment
+`
+
+// scan returns the destinations of equipmentColumns.
+func (e *Equipment) scan() []any {
+	return []any{&e.ID, &e.SourceID, &e.Name, &e.Bay, &e.Type,
+		&e.Manufacturer, &e.Serial, &e.Commissioned, &e.Created}
+}
+
+// equipmentError converts the unique violation of the name.
+func equipmentError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// List() returns the catalogue of the source ordered by bay and name, with
+// the number of curatifs of each equipment.
+func (s *EquipmentStore) List(ctx context.Context, sourceID int) ([]*Equipment, error) {
+	query := `
+SELECT e.id, e.source_id, e.name, e.bay, e.type, e.manufacturer, e.serial,
+       e.commissioned, e.created,
+       COUNT(i.id),
+       COUNT(i.id) FILTER (WHERE i.status NOT IN ('résolu', 'archivé'))
+  FROM equipment AS e
+       LEFT JOIN info AS i
+       ON i.equipment_id = e.id
+ WHERE e.source_id = $1
+ GROUP BY e.id
+ ORDER BY e.bay ASC, lower(e.name) ASC
+`
+
+	rows, err := s.DB.Query(ctx, query, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*Equipment{}
+
+	for rows.Next() {
+		e := &Equipment{}
+
+		err := rows.Scan(append(e.scan(), &e.NbCuratifs, &e.NbOpen)...)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (s *EquipmentStore) Data(ctx context.Context, id int) (*Equipment, error) {
+	query := equipmentColumns + `
+ WHERE id = $1
+`
+
+	return s.get(ctx, query, id)
+}
+
+// ByName() fetch the equipment of the source by its name, case insensitive.
+func (s *EquipmentStore) ByName(ctx context.Context, sourceID int,
+	name string) (*Equipment, error) {
+
+	query := equipmentColumns + `
+ WHERE source_id = $1 AND
+       lower(name) = lower($2)
+`
+
+	return s.get(ctx, query, sourceID, strings.TrimSpace(name))
+}
+
+func (s *EquipmentStore) get(ctx context.Context, query string,
+	args ...any) (*Equipment, error) {
+
+	e := &Equipment{}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(e.scan()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRows
+		}
+
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Attempt to insert the equipment, e.SourceID must be set. ErrDuplicate is
+// returned if the source already has an equipment with this name.
+func (s *EquipmentStore) Insert(ctx context.Context, e *Equipment) (int, error) {
+	query := `
+INSERT INTO equipment (source_id, name, bay, type, manufacturer, serial,
+                       commissioned, created)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+  RETURNING id
+`
+
+	e.Created = time.Now().UTC()
+
+	args := []any{e.SourceID, e.Name, e.Bay, e.Type, e.Manufacturer,
+		e.Serial, e.Commissioned, e.Created}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&e.ID)
+	if err != nil {
+		return 0, equipmentError(err)
+	}
+
+	return e.ID, nil
+}
+
+// Update() changes everything but the source. Same errors as Insert().
+func (s *EquipmentStore) Update(ctx context.Context, e *Equipment) error {
+	query := `
+UPDATE equipment
+   SET name = $1, bay = $2, type = $3, manufacturer = $4, serial = $5,
+       commissioned = $6
+ WHERE id = $7
+`
+
+	args := []any{e.Name, e.Bay, e.Type, e.Manufacturer, e.Serial,
+		e.Commissioned, e.ID}
+
+	result, err := s.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return equipmentError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// Delete() removes the equipment, its curatifs are kept without equipment.
+func (s *EquipmentStore) Delete(ctx context.Context, id int) error {
+	query := `
+DELETE FROM equipment
+ WHERE id = $1
+`
+
+	result, err := s.DB.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// History() returns every curatif of the equipment, archived ones included,
+// the newest first.
+func (s *EquipmentStore) History(ctx context.Context, id int) ([]*Info, error) {
+	query := `
+SELECT id, source_id, material, event, priority, status, agent, target,
+       created, resolved
+  FROM info
+ WHERE equipment_id = $1
+ ORDER BY created DESC, id DESC
+`
+
+	rows, err := s.DB.Query(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infos := []*Info{}
+
+	for rows.Next() {
+		i := &Info{}
+
+		args := []any{&i.ID, &i.SourceID, &i.Material, &i.Event, &i.Priority,
+			&i.Status, &i.Agent, &i.Target, &i.Created, &i.Resolved}
+
+		err := rows.Scan(args...)
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
@@ -5,4 +5,20 @@ import "errors"
 // Global variable to use for each connexion to PSQL
 var (
 	ErrNoRows = errors.New("models: No matching record found")
+
+	// Returned by an update when the row has been modified by someone else
+	// since it was read.
+	ErrEditConflict = errors.New("models: Edit conflict")
+
+	// Returned when a unique value (like a user name) already exists.
+	ErrDuplicate = errors.New("models: Duplicate record")
+
+	// Returned when the GMAO code of a source is used by another one.
+	ErrDuplicateCode = errors.New("models: Duplicate GMAO code")
+
+	// Returned when deleting a source that still has infos.
+	ErrSourceNotEmpty = errors.New("models: Source still has infos")
+
+	// Returned by CSV.Verify() when the file isn't a .csv file.
+	ErrWrongFileType = errors.New("models: Wrong type of file")
 )
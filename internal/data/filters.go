@@ -0,0 +1,135 @@
+package data
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// InfoFilters are the criteria of InfoRepository.List(). A zero value
+// disables the filter: by default every info of the source which isn't
+// archived is listed, ordered by priority.
+type InfoFilters struct {
+	// "archivé" lists the archived infos, which are hidden otherwise.
+	Status   string
+	Priority int
+
+	// Part of the agent name, case is ignored.
+	Agent string
+
+	// Only the open infos whose target date is past.
+	Overdue bool
+
+	// Creation date range, To excluded.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	// One of SortSafelist, a leading "-" means descending order.
+	Sort string
+
+	Page     int
+	PageSize int
+}
+
+// SortSafelist lists the values accepted by InfoFilters.Sort.
+var SortSafelist = []string{
+	"priority", "material", "status", "agent", "target", "created",
+	"-priority", "-material", "-status", "-agent", "-target", "-created",
+}
+
+// Default values of the list, and the max page size.
+const (
+	DefaultSort     = "priority"
+	DefaultPageSize = 25
+	MaxPageSize     = 100
+)
+
+// sortColumn() returns the column of f.Sort, DefaultSort if it isn't in the
+// safelist. The column is put in the query, so it must never come from the
+// user directly.
+func (f InfoFilters) sortColumn() string {
+	for _, safe := range SortSafelist {
+		if f.Sort == safe {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	return DefaultSort
+}
+
+func (f InfoFilters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+func (f InfoFilters) limit() int {
+	if f.PageSize <= 0 {
+		return DefaultPageSize
+	}
+
+	if f.PageSize > MaxPageSize {
+		return MaxPageSize
+	}
+
+	return f.PageSize
+}
+
+func (f InfoFilters) offset() int {
+	if f.Page <= 1 {
+		return 0
+	}
+
+	return (f.Page - 1) * f.limit()
+}
+
+// Metadata describes the page returned by List().
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records"`
+}
+
+func calculateMetadata(totalRecords int, f InfoFilters) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	page := f.Page
+	if page < 1 {
+		page = 1
+	}
+
+	pageSize := f.limit()
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
+// today() returns the day of now in the time zone of the app, at midnight
+// UTC like the dates read by pgx. The queries get it as $n::date rather than
+// using CURRENT_DATE, so they agree with the pages even if the DB runs in
+// another time zone.
+func today(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// isOverdue() is true if the status is open and the target is before the day
+// of now, see Info.Overdue() and today().
+func isOverdue(status string, target *time.Time, now time.Time) bool {
+	if status == "résolu" || status == "archivé" || target == nil {
+		return false
+	}
+
+	return target.Before(today(now))
+}
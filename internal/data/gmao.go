@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+)
+
+// WorkItem is an info to push to the GMAO, with the code_GMAO of its source.
+type WorkItem struct {
+	Info     *Info
+	CodeGMAO string
+}
+
+// Unpushed() returns the open infos without work order whose source has a
+// code_GMAO, the oldest first.
+func (s *InfoStore) Unpushed(ctx context.Context, limit int) ([]*WorkItem, error) {
+	query := `
+SELECT i.id, i.source_id, i.agent, i.material, i.event, i.detail,
+       i.priority, i.target, i.created, s.code_GMAO
+  FROM info AS i
+       JOIN source AS s
+       ON i.source_id = s.id
+ WHERE i.work_order IS NULL AND
+       i.status NOT IN ('résolu', 'archivé') AND
+       COALESCE(s.code_GMAO, '') <> ''
+ ORDER BY i.created ASC, i.id ASC
+ LIMIT $1
+`
+
+	rows, err := s.DB.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*WorkItem{}
+
+	for rows.Next() {
+		w := &WorkItem{Info: &Info{}}
+		i := w.Info
+
+		scan := []any{&i.ID, &i.SourceID, &i.Agent, &i.Material, &i.Event,
+			&i.Detail, &i.Priority, &i.Target, &i.Created, &w.CodeGMAO}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// SetWorkOrder() records the work order of the info. It doesn't change the
+// version: the users editing the info don't conflict with the connector.
+func (s *InfoStore) SetWorkOrder(ctx context.Context, id int, workOrder string) error {
+	query := `
+UPDATE info
+   SET work_order = $1
+ WHERE id = $2
+`
+
+	result, err := s.DB.Exec(ctx, query, workOrder, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// Pushed() returns the open infos having a work order, only with their ID,
+// source, status, doneby and work order.
+func (s *InfoStore) Pushed(ctx context.Context) ([]*Info, error) {
+	query := `
+SELECT id, source_id, status, COALESCE(doneby, ''), work_order
+  FROM info
+ WHERE work_order IS NOT NULL AND
+       status NOT IN ('résolu', 'archivé')
+ ORDER BY id ASC
+`
+
+	rows, err := s.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infos := []*Info{}
+
+	for rows.Next() {
+		i := &Info{}
+
+		err := rows.Scan(&i.ID, &i.SourceID, &i.Status, &i.Doneby,
+			&i.WorkOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
@@ -4,8 +4,7 @@ import (
 	"context"
 	"encoding/csv"
 	"errors"
-	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -38,146 +37,162 @@ import (
 // on le vérifie
 // Si ce n'est pas en UTF-8, on change
 
-// 2 structs sont créées afin de séparer chaque DB
-// pour une meilleure lisibilité
+// Chaque ligne devient une Info, puis toutes les lignes sont envoyées
+// d'un coup via Imports (ImportStore ou MemoryImportStore).
 
 type CSV struct {
-	Info struct {
-		ID       int
-		Priority int
-		SourceID int
-		Agent    string
-		Event    string
-		Created  string // Cast to date with PSQL
-		Material string
-		Pilot    string
-		Detail   string
-		Target   string
-		DayDone  string
-		Estimate string
-		Oups     string
-		Brips    string
-		Ameps    string
-		Status   string
-	}
-	Source struct {
-		ID   int
-		Name string
-
-		Created time.Time
-	}
-	DB *pgxpool.Pool
-
-	ErrorLog *log.Logger
-	InfoLog  *log.Logger
+	Imports ImportRepository
+	Logger  *slog.Logger
 }
 
-func (c *CSV) Verify(s string) {
+// Verify() runs the whole import of the file and returns the first error
+// encountered, so the caller knows the outcome of the import.
+func (c *CSV) Verify(s string) error {
 	file := filepath.Ext(s)
 
 	if file != ".csv" {
-		c.ErrorLog.Println("Wrong type of file")
-	} else {
-		c.encoding(s)
+		return ErrWrongFileType
 	}
+
+	return c.encoding(s)
 }
 
-func (c *CSV) encoding(s string) {
+func (c *CSV) encoding(s string) error {
 	cmd, err := exec.Command("file", "-i", s).Output()
 	if err != nil {
-		c.ErrorLog.Println(err)
+		return err
 	}
 
-	str := []string{}
-	tmp := strings.Split(string(cmd), "=")
-	str = append(str, tmp...)
+	str := strings.Split(string(cmd), "=")
+	if len(str) < 2 {
+		return errors.New("couldn't find the file encoding")
+	}
 
-	tmp2 := strings.ToUpper(str[1])
+	tmp := strings.ToUpper(str[1])
 
-	if tmp2 != "UTF-8\n" {
-		cmd := exec.Command("iconv", "-f", tmp2,
+	if tmp != "UTF-8\n" {
+		cmd := exec.Command("iconv", "-f", strings.TrimSpace(tmp),
 			"-t", "UTF-8", s, "-o", s)
 		err = cmd.Run()
-		c.ErrorLog.Println(err)
+		if err != nil {
+			return err
+		}
 	}
 
-	c.data(s)
+	return c.data(s)
 }
 
-func (c *CSV) data(s string) {
+func (c *CSV) data(s string) error {
+	ctx := context.Background()
+
 	file, err := os.Open(s)
 	if err != nil {
-		c.ErrorLog.Println(err)
+		return err
 	}
 	defer file.Close()
 
 	lines, err := csv.NewReader(file).ReadAll()
 	if err != nil {
-		c.ErrorLog.Println(err)
+		return err
+	}
+
+	if len(lines) < 1 || len(lines[0]) < 1 {
+		return errors.New("empty CSV file")
 	}
 
 	// lines[0][0] == Source name
-	source, err := c.sourceNb(lines[0][0])
+	source, err := c.Imports.SourceID(ctx, lines[0][0])
 	if err != nil {
-		c.ErrorLog.Println(err)
+		return err
 	}
 
+	infos := []*Info{}
+
 	for i, j := 2, 0; i < len(lines); i++ {
 		line := lines[i]
 
-		c.Info.Agent = line[j]
-		c.Info.Event = line[j+1]
-		c.Info.Created = line[j+2]
-		c.Info.Material = line[j+3]
-		c.Info.Detail = line[j+4]
-		c.Info.Target = line[j+5]
-		c.Info.DayDone = line[j+8]
-		c.Info.Priority, _ = strconv.Atoi(line[j+9])
-		c.Info.Estimate = line[j+10]
-		c.Info.Oups = line[j+11]
-		c.Info.Brips = line[j+12]
-		c.Info.Ameps = line[j+13]
-		c.Info.SourceID = source
-
-		if c.Info.Status == "" && c.Info.DayDone == "" &&
-			c.Info.Target == "" {
-			c.Info.Status = "en attente"
-		} else if c.Info.Target != "" && c.Info.DayDone == "" {
-			c.Info.Status = "affecté"
-		} else if c.Info.Target != "" && c.Info.DayDone != "" {
-			c.Info.Status = "résolu"
+		if len(line) < j+14 {
+			c.Logger.Warn("CSV line ignored: not enough columns",
+				"file", s, "line", i+1)
+			continue
 		}
-	}
 
-	c.insert()
-}
+		info := &Info{
+			SourceID: source,
+			Agent:    line[j],
+			Event:    line[j+1],
+			Material: line[j+3],
+			Detail:   line[j+4],
+			DayDone:  line[j+8],
+			Estimate: line[j+10],
+			Oups:     line[j+11],
+			Brips:    line[j+12],
+			Ameps:    line[j+13],
+		}
 
-func (c *CSV) insert() {
-	ctx := context.Background()
-	query := `
-INSERT INTO info
-  (source_id, agent, event, material, pilote, detail, target, day_done,
-    priority, estimate, oups, brips, ameps, created, status)
-  VALUES
-    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
-      (to_date($14, 'DD/MM/YYYY')), %15)
-`
+		info.Priority, _ = strconv.Atoi(line[j+9])
+
+		info.Created, err = time.Parse("02/01/2006", line[j+2])
+		if err != nil {
+			info.Created = time.Now().UTC()
+		}
+
+		target := strings.TrimSpace(line[j+5])
+
+		info.Target, err = parseCSVDate(target)
+		if err != nil {
+			c.Logger.Warn("CSV target isn't a date, kept in the detail",
+				"file", s, "line", i+1, "target", target)
+			info.Detail += "\n\nÉchéance : " + target
+		}
 
-	ci := c.Info
-	args := []any{ci.SourceID, ci.Agent, ci.Event, ci.Material, ci.Pilot,
-		ci.Detail, ci.Target, ci.DayDone, ci.Priority, ci.Estimate,
-		ci.Oups, ci.Brips, ci.Ameps, ci.Created, ci.Status}
+		if info.DayDone == "" && target == "" {
+			info.Status = "en attente"
+		} else if target != "" && info.DayDone == "" {
+			info.Status = "affecté"
+		} else {
+			info.Status = "résolu"
+
+			info.Resolved, err = parseCSVDate(info.DayDone)
+			if err != nil || info.Resolved == nil {
+				created := info.Created
+				info.Resolved = &created
+			}
+		}
 
-	_, err := c.DB.Exec(ctx, query, args...)
+		infos = append(infos, info)
+	}
+
+	n, err := c.Imports.InsertInfos(ctx, infos)
 	if err != nil {
-		c.ErrorLog.Println(err)
+		return err
 	}
 
-	c.InfoLog.Println("data successfuly sent")
+	c.Logger.Info("CSV imported", "file", s, "source_id", source,
+		"infos", n)
+
+	return nil
 }
 
-func (c *CSV) sourceNb(s string) (int, error) {
-	ctx := context.Background()
+// parseCSVDate() parses the French dates of the CSV files, ISO dates being
+// accepted too. An empty string gives nil.
+func parseCSVDate(s string) (*time.Time, error) {
+	t, err := time.Parse("02/01/2006", s)
+	if err == nil {
+		return &t, nil
+	}
+
+	return ParseDate(s)
+}
+
+// ImportStore makes the connexion between CSV and the DB.
+type ImportStore struct {
+	DB *pgxpool.Pool
+}
+
+// SourceID() returns the id of the source with the name written in the CSV
+// file.
+func (s *ImportStore) SourceID(ctx context.Context, name string) (int, error) {
 	query := `
 SELECT id
   FROM source
@@ -185,7 +200,7 @@ SELECT id
 `
 
 	var id int
-	err := c.DB.QueryRow(ctx, query, s).Scan(&id)
+	err := s.DB.QueryRow(ctx, query, name).Scan(&id)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return -1, ErrNoRows
@@ -194,7 +209,41 @@ SELECT id
 		}
 	}
 
-	fmt.Printf("@ sourceNumber: id > %v \n\n", id)
-
 	return id, nil
 }
+
+// InsertInfos() sends every imported info in a single transaction, so a file
+// is either fully imported or not at all.
+func (s *ImportStore) InsertInfos(ctx context.Context, infos []*Info) (int, error) {
+	query := `
+INSERT INTO info
+  (source_id, agent, event, material, detail, target, day_done,
+    priority, estimate, oups, brips, ameps, created, status, resolved)
+  VALUES
+    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+  RETURNING id, version
+`
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, i := range infos {
+		args := []any{i.SourceID, i.Agent, i.Event, i.Material,
+			i.Detail, i.Target, i.DayDone, i.Priority, i.Estimate,
+			i.Oups, i.Brips, i.Ameps, i.Created, i.Status, i.Resolved}
+
+		err := tx.QueryRow(ctx, query, args...).Scan(&i.ID, &i.Version)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(infos), nil
+}
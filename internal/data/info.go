@@ -3,7 +3,9 @@ package data
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -11,45 +13,119 @@ import (
 )
 
 type Info struct {
-	ID       int    `json:"-"`
-	Priority int    `json:"priority,omitempty"`
-	SourceID int    `json:"-"` // foreign key en référence au PK de source
-	Counter  int    `json:"counter,omitempty"`
-	Agent    string `json:"agent,omitempty"`
-	Material string `json:"material,omitempty"`
-	Target   string `json:"target,omitempty"`
-	Rte      string `json:"rte,omitempty"`
-	Detail   string `json:"detail,omitempty"`
-	Estimate string `json:"estimate,omitempty"`
-	Brips    string `json:"brips,omitempty"`
-	Oups     string `json:"oups,omitempty"`
-	Ameps    string `json:"ameps,omitempty"`
-	Ais      string `json:"ais,omitempty"`
-	Status   string `json:"status,omitempty"`
-	Event    string `json:"event,omitempty"`
-	Doneby   string `json:"doneby,omitempty"`
-	DayDone  string `json:"dayDone,omitempty"`
+	ID       int        `json:"-"`
+	Priority int        `json:"priority,omitempty"`
+	SourceID int        `json:"-"` // foreign key en référence au PK de source
+	Counter  int        `json:"counter,omitempty"`
+	Version  int        `json:"version"`
+	Agent    string     `json:"agent,omitempty"`
+	Material string     `json:"material,omitempty"`
+	Target   *time.Time `json:"target,omitempty"` // nil if not planned
+	Rte      string     `json:"rte,omitempty"`
+	Detail   string     `json:"detail,omitempty"`
+	Estimate string     `json:"estimate,omitempty"`
+	Brips    string     `json:"brips,omitempty"`
+	Oups     string     `json:"oups,omitempty"`
+	Ameps    string     `json:"ameps,omitempty"`
+	Ais      string     `json:"ais,omitempty"`
+	Status   string     `json:"status,omitempty"`
+	Event    string     `json:"event,omitempty"`
+	Doneby   string     `json:"doneby,omitempty"`
+	DayDone  string     `json:"dayDone,omitempty"`
 
 	ZeroTime time.Time `json:"-"`
 	Created  time.Time `json:"-"`
 	Updated  time.Time `json:"-"`
 
-	InfoLog  *log.Logger
-	ErrorLog *log.Logger
+	// When the info was set to résolu, nil while it's open. Used by the SLA
+	// report.
+	Resolved *time.Time `json:"resolved,omitempty"`
+
+	// When the overdue email was queued, see MarkOverdue().
+	OverdueNotified *time.Time `json:"-"`
+
+	// ID of the work order in the GMAO, empty until the info is pushed.
+	WorkOrder string `json:"work_order,omitempty"`
+
+	// Item of the catalogue of the source, 0 if none. Equipment is its name,
+	// only set by Data().
+	EquipmentID int    `json:"equipment_id,omitempty"`
+	Equipment   string `json:"equipment,omitempty"`
+}
+
+// DateLayout is the format of the target dates in the forms, the API and the
+// exported files, the one of the date inputs.
+const DateLayout = "2006-01-02"
+
+// ParseDate() parses a DateLayout date, an empty string giving nil.
+func ParseDate(s string) (*time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
 }
 
-func (i *Info) ActiveInfo(conn *pgxpool.Conn) ([]*Info, error) {
-	ctx := context.Background()
+// TargetDate() returns the target in DateLayout, "" if there's none.
+func (i *Info) TargetDate() string {
+	if i.Target == nil {
+		return ""
+	}
+
+	return i.Target.Format(DateLayout)
+}
+
+// Overdue() is true if the info is still open while its target date is past.
+func (i *Info) Overdue() bool {
+	return isOverdue(i.Status, i.Target, time.Now())
+}
+
+// resolvedAt() returns the resolved date of an info having the status: the
+// current one (nil if not resolved yet) or now. It's nil for the open infos.
+func resolvedAt(status string, current *time.Time, now time.Time) *time.Time {
+	if status != "résolu" && status != "archivé" {
+		return nil
+	}
+
+	if current != nil {
+		return current
+	}
+
+	return &now
+}
+
+// OpenCount is the number of open infos (not résolu nor archivé) of a source
+// for one priority.
+type OpenCount struct {
+	SourceID int
+	Source   string
+	Priority int
+	Count    int
+}
+
+// InfoStore makes the connexion between the handlers and the info table.
+// Like SourceStore, every method returns new Info values.
+type InfoStore struct {
+	DB     *pgxpool.Pool
+	Logger *slog.Logger
+}
 
+func (s *InfoStore) ActiveInfo(ctx context.Context) ([]*Info, error) {
 	query := `
-SELECT i.material, 
+SELECT i.material,
        i.detail
   FROM info AS i
  WHERE status <> 'résolu' AND
-       status <> 'archivé' 
+       status <> 'archivé'
 `
 
-	rows, err := conn.Query(ctx, query)
+	rows, err := s.DB.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +134,7 @@ SELECT i.material,
 	infos := []*Info{}
 
 	for rows.Next() {
-		// i := &Info{}
+		i := &Info{}
 
 		err := rows.Scan(&i.Material, &i.Detail)
 		if err != nil {
@@ -75,58 +151,105 @@ SELECT i.material,
 	return infos, nil
 }
 
-// Send data to DB
-func (i *Info) Insert(id int, conn *pgxpool.Conn) (int, error) {
-	ctx := context.Background()
+// OpenCounts() counts the open infos per source and priority.
+func (s *InfoStore) OpenCounts(ctx context.Context) ([]*OpenCount, error) {
+	query := `
+SELECT s.id, s.name, i.priority, COUNT(*)
+  FROM info AS i
+       JOIN source AS s
+       ON i.source_id = s.id
+ WHERE i.status <> 'résolu' AND
+       i.status <> 'archivé'
+ GROUP BY s.id, i.priority
+ ORDER BY s.name ASC, i.priority ASC
+`
+
+	rows, err := s.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []*OpenCount{}
+
+	for rows.Next() {
+		c := &OpenCount{}
+
+		err := rows.Scan(&c.SourceID, &c.Source, &c.Priority, &c.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, c)
+	}
 
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// Send data to DB. i.SourceID must be set, i.ID, i.Created and i.Version are
+// set on success.
+func (s *InfoStore) Insert(ctx context.Context, i *Info) (int, error) {
 	query := `
-INSERT INTO info (source_id, agent, material, detail, 
+INSERT INTO info (source_id, agent, material, detail,
 	   	  event, priority, oups, ameps,
-       		  brips, rte, ais, estimate, 
-		  target, status, doneby, created)
-VALUES ($1,  $2,  $3,  $4, 
-	$5,  $6,  $7,  $8, 
-	$9,  $10, $11, $12, 
-	$13, $14, $15, $16)
-  RETURNING id;
+       		  brips, rte, ais, estimate,
+		  target, status, doneby, created,
+		  resolved, equipment_id)
+VALUES ($1,  $2,  $3,  $4,
+	$5,  $6,  $7,  $8,
+	$9,  $10, $11, $12,
+	$13, $14, $15, $16,
+	$17, NULLIF($18, 0))
+  RETURNING id, version;
         `
 
-	args := []any{id, i.Agent, i.Material, i.Detail, i.Event, i.Priority,
-		i.Oups, i.Ameps, i.Brips, i.Rte, i.Ais, i.Estimate,
-		i.Target, i.Status, i.Doneby, time.Now().UTC()}
+	i.Created = time.Now().UTC()
+	i.Resolved = resolvedAt(i.Status, i.Resolved, i.Created)
 
-	err := conn.QueryRow(ctx, query, args...).Scan(&i.ID)
+	args := []any{i.SourceID, i.Agent, i.Material, i.Detail, i.Event,
+		i.Priority, i.Oups, i.Ameps, i.Brips, i.Rte, i.Ais, i.Estimate,
+		i.Target, i.Status, i.Doneby, i.Created, i.Resolved, i.EquipmentID}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&i.ID, &i.Version)
 	if err != nil {
-		i.InfoLog.Println("Could not insert info data!")
-		return 0, nil
+		s.Logger.Error("could not insert info", "source_id", i.SourceID,
+			"error", err)
+		return 0, err
 	}
 
 	return i.ID, nil
 }
 
 // Fetch Info data so it can be displayed @ infoView page.
-func (i *Info) Data(id int, conn *pgxpool.Conn) (*Info, error) {
-	ctx := context.Background()
-
+func (s *InfoStore) Data(ctx context.Context, id int) (*Info, error) {
 	query := `
-SELECT id, agent, material, priority, 
+SELECT id, agent, material, priority,
        rte, detail, estimate, brips,
-       oups, ameps, ais, source_id, 
-       created, updated, status, event, target, doneby
+       oups, ameps, ais, source_id,
+       created, updated, status, event, target, doneby, version,
+       COALESCE(work_order, ''), COALESCE(equipment_id, 0),
+       COALESCE((SELECT name FROM equipment WHERE id = equipment_id), '')
   FROM info
- WHERE id = $1 AND 
+ WHERE id = $1 AND
  status <> 'résolu'
         `
 
-	var rte, ameps, ais, brips, oups, estimate, target, doneby *string
+	i := &Info{}
+
+	var rte, ameps, ais, brips, oups, estimate, doneby *string
 	var updated *time.Time
 
-	scan := []any{&i.ID, &i.Agent, &i.Material, &i.Priority, &i.Rte,
-		&i.Detail, &i.Estimate, &i.Brips, &i.Oups, &i.Ameps,
-		&i.Ais, &i.SourceID, &i.Created, &i.Updated, &i.Status,
-		&i.Event, &i.Target, &i.Doneby}
+	scan := []any{&i.ID, &i.Agent, &i.Material, &i.Priority, &rte,
+		&i.Detail, &estimate, &brips, &oups, &ameps,
+		&ais, &i.SourceID, &i.Created, &updated, &i.Status,
+		&i.Event, &i.Target, &doneby, &i.Version, &i.WorkOrder,
+		&i.EquipmentID, &i.Equipment}
 
-	err := conn.QueryRow(ctx, query).Scan(scan...)
+	err := s.DB.QueryRow(ctx, query, id).Scan(scan...)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrNoRows
@@ -141,10 +264,6 @@ SELECT id, agent, material, priority,
 	// PSQL returns NULL if empty row, Golang doesn't supporty NULL value
 	// but nil value. Then we cast to a pointer.
 
-	if target != nil {
-		i.Target = *target
-	}
-
 	if rte != nil {
 		i.Rte = *rte
 	}
@@ -180,95 +299,166 @@ SELECT id, agent, material, priority,
 	return i, nil
 }
 
-// List() fetch every info associated to it's Source so it can be displayed by
-// infoView handler
-func (i *Info) List(id int, conn *pgxpool.Conn) ([]*Info, error) {
-	ctx := context.Background()
-
-	query := `
-SELECT id, material, created, status, source_id, priority
+// List() fetch the infos of a source matching the filters so they can be
+// displayed by sourceView handler. The metadata gives the total number of
+// infos matching and the pages.
+func (s *InfoStore) List(ctx context.Context, id int, f InfoFilters) ([]*Info, Metadata, error) {
+	// The sort column comes from the safelist, never from the user.
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, material, created, status, source_id, priority,
+       agent, target
   FROM info
- WHERE source_id = $1 AND status <> 'archivé'
- ORDER BY priority ASC
-`
-
-	rows, err := conn.Query(ctx, query, id)
+ WHERE source_id = $1 AND
+       (($2 = '' AND status <> 'archivé') OR status = $2) AND
+       ($3 = 0 OR priority = $3) AND
+       ($4 = '' OR agent ILIKE '%%' || $4 || '%%') AND
+       (NOT $5 OR (status NOT IN ('résolu', 'archivé') AND
+                   target < $10::date)) AND
+       ($6::timestamp IS NULL OR created >= $6) AND
+       ($7::timestamp IS NULL OR created < $7)
+ ORDER BY %s %s NULLS LAST, id ASC
+ LIMIT $8 OFFSET $9
+`, f.sortColumn(), f.sortDirection())
+
+	args := []any{id, f.Status, f.Priority, f.Agent, f.Overdue,
+		nullTime(f.CreatedFrom), nullTime(f.CreatedTo), f.limit(), f.offset(),
+		today(time.Now())}
+
+	rows, err := s.DB.Query(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	infos := []*Info{}
 
 	for rows.Next() {
-		args := []any{&i.ID, &i.Material, &i.Created, &i.Status,
-			&i.SourceID, &i.Priority}
+		i := &Info{}
+
+		args := []any{&totalRecords, &i.ID, &i.Material, &i.Created,
+			&i.Status, &i.SourceID, &i.Priority, &i.Agent, &i.Target}
 
 		err = rows.Scan(args...)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
 		infos = append(infos, i)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
-	return infos, nil
+	return infos, calculateMetadata(totalRecords, f), nil
 }
 
-func (i *Info) Delete(id int, conn *pgxpool.Conn) error {
-	ctx := context.Background()
+// nullTime() sends a zero time as NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
 
+func (s *InfoStore) Delete(ctx context.Context, id int) error {
 	query := `
-DELETE FROM info 
+DELETE FROM info
  WHERE id = $1
 `
-	_, err := conn.Exec(ctx, query, id)
+	result, err := s.DB.Exec(ctx, query, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
 
+	return nil
 }
 
-func (i *Info) Update(id int, conn *pgxpool.Conn) error {
-	ctx := context.Background()
-
+// MarkOverdue() returns the open infos whose target is past and which weren't
+// returned yet: they are marked so each overdue email is only sent once. An
+// info is returned again if its target changes.
+func (s *InfoStore) MarkOverdue(ctx context.Context) ([]*Info, error) {
 	query := `
 UPDATE info
-   SET agent = $1, material = $2, priority = $3, target = $4, rte = $5,
-       detail = $6, estimate = $7, brips = $8, oups = $9, ameps = $10,
-       ais = $11, updated = $12, status = $13, event = $14, doneby = $15
- WHERE id = $16
+   SET overdue_notified = $1
+ WHERE status NOT IN ('résolu', 'archivé') AND
+       target < $2::date AND
+       overdue_notified IS NULL
+ RETURNING id, source_id, agent, material, priority, status, event, target
 `
-	args := []any{i.Agent, i.Material, i.Priority, i.Target, i.Rte,
-		i.Detail, i.Estimate, i.Brips, i.Oups, i.Ameps,
-		i.Ais, time.Now().UTC(), i.Status, i.Event, i.Doneby, id}
 
-	_, err := conn.Exec(ctx, query, args...)
+	now := time.Now()
+
+	rows, err := s.DB.Query(ctx, query, now.UTC(), today(now))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
-}
+	infos := []*Info{}
+
+	for rows.Next() {
+		i := &Info{}
+
+		scan := []any{&i.ID, &i.SourceID, &i.Agent, &i.Material, &i.Priority,
+			&i.Status, &i.Event, &i.Target}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
-func (i *Info) Test(id int, conn *pgxpool.Conn) error {
-	ctx := context.Background()
+	return infos, nil
+}
 
+// Update() only succeeds if the info still has the version that was read
+// before the edit (i.Version). Otherwise someone else modified it in the
+// meantime and ErrEditConflict is returned. On success i.Version is set to the
+// new version, and i.Resolved to the date it was resolved.
+func (s *InfoStore) Update(ctx context.Context, i *Info) error {
 	query := `
 UPDATE info
-   SET material = $1, updated = $2
- WHERE id = $3
+   SET agent = $1, material = $2, priority = $3, target = $4, rte = $5,
+       detail = $6, estimate = $7, brips = $8, oups = $9, ameps = $10,
+       ais = $11, updated = $12, status = $13, event = $14, doneby = $15,
+       equipment_id = NULLIF($18, 0),
+       resolved = CASE
+                  WHEN $13 IN ('résolu', 'archivé') THEN COALESCE(resolved, $12)
+                  END,
+       overdue_notified = CASE
+                          WHEN target IS DISTINCT FROM $4 THEN NULL
+                          ELSE overdue_notified
+                          END,
+       version = version + 1
+ WHERE id = $16 AND version = $17
+ RETURNING version, resolved
 `
-	args := []any{i.Material, time.Now().UTC(), id}
+	i.Updated = time.Now().UTC()
 
-	_, err := conn.Exec(ctx, query, args...)
+	args := []any{i.Agent, i.Material, i.Priority, i.Target, i.Rte,
+		i.Detail, i.Estimate, i.Brips, i.Oups, i.Ameps,
+		i.Ais, i.Updated, i.Status, i.Event, i.Doneby, i.ID,
+		i.Version, i.EquipmentID}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&i.Version, &i.Resolved)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrEditConflict
+		}
+
 		return err
 	}
 
@@ -0,0 +1,1828 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memory holds the tables used by the in-memory stores. Each store only
+// works on copies, so a value returned to a caller can't modify the "DB".
+type memory struct {
+	mu sync.Mutex
+
+	sources map[int]Source
+	infos   map[int]Info
+	users   map[int]User
+	views   map[int]SavedView
+	slas    map[int]SLA
+	outbox  map[int]Email
+	hooks   map[int]Webhook
+	calls   map[int]Delivery
+	history []historyRow
+
+	equipment map[int]Equipment
+
+	lastSource int
+	lastInfo   int
+	lastUser   int
+	lastView   int
+	lastSLA    int
+	lastEmail  int
+	lastHook   int
+	lastCall   int
+
+	lastEquipment int
+}
+
+// Same columns as the history table.
+type historyRow struct {
+	InfoID   int
+	SourceID int
+	Action   string
+	Detail   string
+	Created  time.Time
+}
+
+func newMemory() *memory {
+	m := &memory{
+		sources: make(map[int]Source),
+		infos:   make(map[int]Info),
+		users:   make(map[int]User),
+		views:   make(map[int]SavedView),
+		slas:    make(map[int]SLA),
+		outbox:  make(map[int]Email),
+		hooks:   make(map[int]Webhook),
+		calls:   make(map[int]Delivery),
+
+		equipment: make(map[int]Equipment),
+	}
+
+	// Default rules of migration 000008.
+	for p, days := range []int{7, 30, 90, 180} {
+		m.insertSLA(&SLA{Priority: p + 1, Days: days})
+	}
+
+	return m
+}
+
+// ##################
+// MemorySourceStore
+// ##################
+
+type MemorySourceStore struct {
+	m *memory
+}
+
+// Same as SourceStore.GetAllActive().
+func (s *MemorySourceStore) GetAllActive(ctx context.Context) ([]*Source, error) {
+	sources := s.count(func(i Info) bool {
+		return i.Status != "archivé" && i.Status != "résolu"
+	})
+
+	now := time.Now()
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, src := range sources {
+		for _, i := range s.m.infos {
+			if i.SourceID == src.ID && isOverdue(i.Status, i.Target, now) {
+				src.NbOverdue++
+			}
+		}
+	}
+
+	return sources, nil
+}
+
+// Same as SourceStore.InfoSolved().
+func (s *MemorySourceStore) InfoSolved(ctx context.Context) ([]*Source, error) {
+	return s.count(func(i Info) bool {
+		return i.Status == "résolu"
+	}), nil
+}
+
+// Same as SourceStore.Digest().
+func (s *MemorySourceStore) Digest(ctx context.Context, from, to time.Time,
+	limit int) ([]*Digest, error) {
+
+	sources := s.count(func(Info) bool { return false })
+	now := time.Now()
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	infos := s.m.sortedInfos()
+
+	// Oldest first, like the ORDER BY of the query.
+	sort.SliceStable(infos, func(a, b int) bool {
+		return infos[a].Created.Before(infos[b].Created)
+	})
+
+	within := func(t *time.Time) bool {
+		return t != nil && !t.Before(from) && t.Before(to)
+	}
+
+	digests := []*Digest{}
+
+	for _, src := range sources {
+		d := &Digest{SourceID: src.ID, Source: src.Name, Overdue: []*Info{},
+			Oldest: []*Info{}}
+
+		overdue := []*Info{}
+
+		for _, i := range infos {
+			if i.SourceID != src.ID {
+				continue
+			}
+
+			i := i
+
+			if within(&i.Created) {
+				d.New++
+			}
+
+			if within(i.Resolved) {
+				d.Resolved++
+			}
+
+			if i.Status == "résolu" || i.Status == "archivé" {
+				continue
+			}
+
+			d.Open++
+
+			if len(d.Oldest) < limit {
+				d.Oldest = append(d.Oldest, &i)
+			}
+
+			if i.Priority <= DigestPriority && isOverdue(i.Status, i.Target, now) {
+				overdue = append(overdue, &i)
+			}
+		}
+
+		sort.SliceStable(overdue, func(a, b int) bool {
+			return overdue[a].Target.Before(*overdue[b].Target)
+		})
+
+		d.NbOverdue = len(overdue)
+		d.Overdue = overdue[:min(limit, len(overdue))]
+
+		digests = append(digests, d)
+	}
+
+	return digests, nil
+}
+
+// count() returns every source ordered by name with NbCuratifs being the
+// number of infos matching the filter.
+func (s *MemorySourceStore) count(filter func(Info) bool) []*Source {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sources := []*Source{}
+
+	for _, src := range s.m.sources {
+		src := src
+		src.NbCuratifs = 0
+
+		for _, i := range s.m.infos {
+			if i.SourceID == src.ID && filter(i) {
+				src.NbCuratifs++
+			}
+		}
+
+		sources = append(sources, &src)
+	}
+
+	sort.Slice(sources, func(a, b int) bool {
+		return sources[a].Name < sources[b].Name
+	})
+
+	return sources
+}
+
+func (s *MemorySourceStore) Data(ctx context.Context, id int) (*Source, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	src, ok := s.m.sources[id]
+	if !ok {
+		return nil, ErrNoRows
+	}
+
+	return &src, nil
+}
+
+func (s *MemorySourceStore) Insert(ctx context.Context, src *Source) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if err := s.unique(src); err != nil {
+		return 0, err
+	}
+
+	s.m.lastSource++
+
+	src.ID = s.m.lastSource
+	src.Created = time.Now().UTC()
+
+	s.m.sources[src.ID] = *src
+
+	return src.ID, nil
+}
+
+// Like the foreign key in PSQL, a source with infos can't be deleted.
+func (s *MemorySourceStore) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.sources[id]; !ok {
+		return ErrNoRows
+	}
+
+	for _, i := range s.m.infos {
+		if i.SourceID == id {
+			return ErrSourceNotEmpty
+		}
+	}
+
+	delete(s.m.sources, id)
+
+	// ON DELETE CASCADE
+	for _, v := range s.m.views {
+		if v.SourceID == id {
+			delete(s.m.views, v.ID)
+		}
+	}
+
+	for _, r := range s.m.slas {
+		if r.SourceID == id {
+			delete(s.m.slas, r.ID)
+		}
+	}
+
+	for _, e := range s.m.equipment {
+		if e.SourceID == id {
+			delete(s.m.equipment, e.ID)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySourceStore) Update(ctx context.Context, src *Source) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.sources[src.ID]
+	if !ok {
+		return ErrNoRows
+	}
+
+	if err := s.unique(src); err != nil {
+		return err
+	}
+
+	stored.Name = src.Name
+	stored.ArchiveAfter = src.ArchiveAfter
+	stored.CodeGMAO = src.CodeGMAO
+	stored.VoltageKV = src.VoltageKV
+	stored.Address = src.Address
+	stored.Latitude = src.Latitude
+	stored.Longitude = src.Longitude
+	stored.Team = src.Team
+	stored.Notes = src.Notes
+
+	s.m.sources[src.ID] = stored
+
+	return nil
+}
+
+// unique() checks the unique name and GMAO code of the source table. The
+// caller holds the lock.
+func (s *MemorySourceStore) unique(src *Source) error {
+	for _, other := range s.m.sources {
+		if other.ID == src.ID {
+			continue
+		}
+
+		if other.Name == src.Name {
+			return ErrDuplicate
+		}
+
+		if src.CodeGMAO != "" && other.CodeGMAO == src.CodeGMAO {
+			return ErrDuplicateCode
+		}
+	}
+
+	return nil
+}
+
+// ###############
+// MemoryInfoStore
+// ###############
+
+type MemoryInfoStore struct {
+	m *memory
+}
+
+// Same as InfoStore.ActiveInfo(), only material and detail are set.
+func (s *MemoryInfoStore) ActiveInfo(ctx context.Context) ([]*Info, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	infos := []*Info{}
+
+	for _, i := range s.m.sortedInfos() {
+		if i.Status != "résolu" && i.Status != "archivé" {
+			infos = append(infos, &Info{Material: i.Material, Detail: i.Detail})
+		}
+	}
+
+	return infos, nil
+}
+
+// Same as InfoStore.OpenCounts().
+func (s *MemoryInfoStore) OpenCounts(ctx context.Context) ([]*OpenCount, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	byKey := map[[2]int]*OpenCount{}
+	counts := []*OpenCount{}
+
+	for _, i := range s.m.sortedInfos() {
+		if i.Status == "résolu" || i.Status == "archivé" {
+			continue
+		}
+
+		key := [2]int{i.SourceID, i.Priority}
+
+		c, ok := byKey[key]
+		if !ok {
+			c = &OpenCount{
+				SourceID: i.SourceID,
+				Source:   s.m.sources[i.SourceID].Name,
+				Priority: i.Priority,
+			}
+			byKey[key] = c
+			counts = append(counts, c)
+		}
+
+		c.Count++
+	}
+
+	sort.Slice(counts, func(a, b int) bool {
+		if counts[a].Source != counts[b].Source {
+			return counts[a].Source < counts[b].Source
+		}
+
+		return counts[a].Priority < counts[b].Priority
+	})
+
+	return counts, nil
+}
+
+func (s *MemoryInfoStore) Insert(ctx context.Context, i *Info) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.m.insertInfo(i)
+}
+
+// Same as InfoStore.Data(), a resolved info isn't returned.
+func (s *MemoryInfoStore) Data(ctx context.Context, id int) (*Info, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	i, ok := s.m.infos[id]
+	if !ok || i.Status == "résolu" {
+		return nil, ErrNoRows
+	}
+
+	i.ZeroTime = time.Date(0001, time.January, 1, 0, 0, 0, 0, time.UTC)
+	i.Equipment = s.m.equipment[i.EquipmentID].Name
+
+	return &i, nil
+}
+
+// Same as InfoStore.List().
+func (s *MemoryInfoStore) List(ctx context.Context, id int, f InfoFilters) ([]*Info, Metadata, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	agent := strings.ToLower(f.Agent)
+
+	infos := []*Info{}
+
+	for _, i := range s.m.sortedInfos() {
+		switch {
+		case i.SourceID != id:
+			continue
+		case f.Status == "" && i.Status == "archivé":
+			continue
+		case f.Status != "" && i.Status != f.Status:
+			continue
+		case f.Priority != 0 && i.Priority != f.Priority:
+			continue
+		case agent != "" && !strings.Contains(strings.ToLower(i.Agent), agent):
+			continue
+		case f.Overdue && !isOverdue(i.Status, i.Target, now):
+			continue
+		case !f.CreatedFrom.IsZero() && i.Created.Before(f.CreatedFrom):
+			continue
+		case !f.CreatedTo.IsZero() && !i.Created.Before(f.CreatedTo):
+			continue
+		}
+
+		infos = append(infos, &Info{
+			ID:       i.ID,
+			Material: i.Material,
+			Created:  i.Created,
+			Status:   i.Status,
+			SourceID: i.SourceID,
+			Priority: i.Priority,
+			Agent:    i.Agent,
+			Target:   i.Target,
+		})
+	}
+
+	less := map[string]func(a, b *Info) bool{
+		"priority": func(a, b *Info) bool { return a.Priority < b.Priority },
+		"material": func(a, b *Info) bool { return a.Material < b.Material },
+		"status":   func(a, b *Info) bool { return a.Status < b.Status },
+		"agent":    func(a, b *Info) bool { return a.Agent < b.Agent },
+		"target": func(a, b *Info) bool {
+			return a.Target != nil && b.Target != nil &&
+				a.Target.Before(*b.Target)
+		},
+		"created": func(a, b *Info) bool { return a.Created.Before(b.Created) },
+	}[f.sortColumn()]
+
+	desc := f.sortDirection() == "DESC"
+
+	// infos are ordered by ID, the stable sort keeps it for equal values.
+	// Like NULLS LAST, the infos without target stay at the end.
+	sort.SliceStable(infos, func(a, b int) bool {
+		if (infos[a].Target == nil) != (infos[b].Target == nil) &&
+			f.sortColumn() == "target" {
+			return infos[b].Target == nil
+		}
+
+		if desc {
+			return less(infos[b], infos[a])
+		}
+
+		return less(infos[a], infos[b])
+	})
+
+	// Like count(*) OVER(), a page after the last one has no metadata.
+	start := f.offset()
+	if start >= len(infos) {
+		return []*Info{}, Metadata{}, nil
+	}
+
+	metadata := calculateMetadata(len(infos), f)
+
+	end := start + f.limit()
+	if end > len(infos) {
+		end = len(infos)
+	}
+
+	return infos[start:end], metadata, nil
+}
+
+// Same as InfoStore.MarkOverdue().
+func (s *MemoryInfoStore) MarkOverdue(ctx context.Context) ([]*Info, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now().UTC()
+	infos := []*Info{}
+
+	for _, i := range s.m.sortedInfos() {
+		if i.OverdueNotified != nil || !isOverdue(i.Status, i.Target, now) {
+			continue
+		}
+
+		i.OverdueNotified = &now
+		s.m.infos[i.ID] = i
+
+		infos = append(infos, &Info{
+			ID:       i.ID,
+			SourceID: i.SourceID,
+			Agent:    i.Agent,
+			Material: i.Material,
+			Priority: i.Priority,
+			Status:   i.Status,
+			Event:    i.Event,
+			Target:   i.Target,
+		})
+	}
+
+	return infos, nil
+}
+
+func (s *MemoryInfoStore) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.infos[id]; !ok {
+		return ErrNoRows
+	}
+
+	delete(s.m.infos, id)
+
+	return nil
+}
+
+// Same as InfoStore.Update(), the version must match the stored one.
+func (s *MemoryInfoStore) Update(ctx context.Context, i *Info) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.infos[i.ID]
+	if !ok || stored.Version != i.Version {
+		return ErrEditConflict
+	}
+
+	i.Updated = time.Now().UTC()
+	i.Version = stored.Version + 1
+	i.SourceID = stored.SourceID
+	i.Created = stored.Created
+	i.Resolved = resolvedAt(i.Status, stored.Resolved, i.Updated)
+
+	i.WorkOrder = stored.WorkOrder
+
+	if sameDate(i.Target, stored.Target) {
+		i.OverdueNotified = stored.OverdueNotified
+	} else {
+		i.OverdueNotified = nil
+	}
+
+	s.m.infos[i.ID] = *i
+
+	return nil
+}
+
+// Same as InfoStore.Unpushed().
+func (s *MemoryInfoStore) Unpushed(ctx context.Context, limit int) ([]*WorkItem, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	items := []*WorkItem{}
+
+	for _, i := range s.m.sortedInfos() {
+		i := i
+		code := s.m.sources[i.SourceID].CodeGMAO
+
+		if i.WorkOrder == "" && i.Status != "résolu" && i.Status != "archivé" &&
+			code != "" {
+			items = append(items, &WorkItem{Info: &i, CodeGMAO: code})
+		}
+	}
+
+	// The oldest first, the imported infos keep the date of the file.
+	sort.SliceStable(items, func(a, b int) bool {
+		return items[a].Info.Created.Before(items[b].Info.Created)
+	})
+
+	return items[:min(limit, len(items))], nil
+}
+
+func (s *MemoryInfoStore) SetWorkOrder(ctx context.Context, id int, workOrder string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	i, ok := s.m.infos[id]
+	if !ok {
+		return ErrNoRows
+	}
+
+	i.WorkOrder = workOrder
+	s.m.infos[id] = i
+
+	return nil
+}
+
+// Same as InfoStore.Pushed(), every field is set.
+func (s *MemoryInfoStore) Pushed(ctx context.Context) ([]*Info, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	infos := []*Info{}
+
+	for _, i := range s.m.sortedInfos() {
+		i := i
+
+		if i.WorkOrder != "" && i.Status != "résolu" && i.Status != "archivé" {
+			infos = append(infos, &i)
+		}
+	}
+
+	return infos, nil
+}
+
+// Same as InfoStore.ArchiveResolved().
+func (s *MemoryInfoStore) ArchiveResolved(ctx context.Context, days int) ([]*Info, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	return s.m.archive(now, func(i Info) bool {
+		after := days
+		if src := s.m.sources[i.SourceID]; src.ArchiveAfter != nil {
+			after = *src.ArchiveAfter
+		}
+
+		return after > 0 && i.Resolved != nil &&
+			i.Resolved.Before(now.AddDate(0, 0, -after))
+	}), nil
+}
+
+// Same as InfoStore.ArchiveSource().
+func (s *MemoryInfoStore) ArchiveSource(ctx context.Context, id int) ([]*Info, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.m.archive(time.Now().UTC(), func(i Info) bool {
+		return i.SourceID == id
+	}), nil
+}
+
+// Same as InfoStore.Recurring().
+func (s *MemoryInfoStore) Recurring(ctx context.Context, f RecurringFilters) ([]*Recurrence, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	type key struct {
+		sourceID    int
+		equipmentID int
+		label       string
+	}
+
+	byKey := make(map[key]*Recurrence)
+	groups := []*Recurrence{}
+
+	for _, i := range s.m.sortedInfos() {
+		if i.Created.Before(f.From) {
+			continue
+		}
+
+		if f.OpenOnly && (i.Status == "résolu" || i.Status == "archivé") {
+			continue
+		}
+
+		i := i
+		k := key{sourceID: i.SourceID, equipmentID: i.EquipmentID}
+
+		if e, ok := s.m.equipment[i.EquipmentID]; ok {
+			k.label = e.Name
+		} else {
+			k.equipmentID = 0
+			k.label = NormalizeMaterial(i.Material)
+		}
+
+		r, ok := byKey[k]
+		if !ok {
+			r = &Recurrence{SourceID: k.sourceID, EquipmentID: k.equipmentID,
+				Source: s.m.sources[i.SourceID].Name, Label: k.label}
+			byKey[k] = r
+			groups = append(groups, r)
+		}
+
+		r.Infos = append(r.Infos, &i)
+	}
+
+	recurring := []*Recurrence{}
+
+	for _, r := range groups {
+		if len(r.Infos) < f.Min {
+			continue
+		}
+
+		sort.Slice(r.Infos, func(a, b int) bool {
+			if !r.Infos[a].Created.Equal(r.Infos[b].Created) {
+				return r.Infos[a].Created.After(r.Infos[b].Created)
+			}
+
+			return r.Infos[a].ID > r.Infos[b].ID
+		})
+
+		recurring = append(recurring, r)
+	}
+
+	sort.SliceStable(recurring, func(a, b int) bool {
+		ra, rb := recurring[a], recurring[b]
+
+		switch {
+		case len(ra.Infos) != len(rb.Infos):
+			return len(ra.Infos) > len(rb.Infos)
+		case ra.Source != rb.Source:
+			return ra.Source < rb.Source
+		case ra.Label != rb.Label:
+			return ra.Label < rb.Label
+		}
+
+		return ra.EquipmentID < rb.EquipmentID
+	})
+
+	return recurring, nil
+}
+
+// #################
+// MemoryImportStore
+// #################
+
+type MemoryImportStore struct {
+	m *memory
+}
+
+func (s *MemoryImportStore) SourceID(ctx context.Context, name string) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, src := range s.m.sources {
+		if src.Name == name {
+			return src.ID, nil
+		}
+	}
+
+	return -1, ErrNoRows
+}
+
+// Like the PSQL transaction, nothing is inserted if one of the infos fails.
+func (s *MemoryImportStore) InsertInfos(ctx context.Context, infos []*Info) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, i := range infos {
+		if _, ok := s.m.sources[i.SourceID]; !ok {
+			return 0, ErrNoRows
+		}
+	}
+
+	for _, i := range infos {
+		created := i.Created
+
+		if _, err := s.m.insertInfo(i); err != nil {
+			return 0, err
+		}
+
+		// Imported infos keep the date written in the file.
+		if !created.IsZero() {
+			i.Created = created
+			stored := s.m.infos[i.ID]
+			stored.Created = created
+			s.m.infos[i.ID] = stored
+		}
+	}
+
+	return len(infos), nil
+}
+
+// ###############
+// MemoryUserStore
+// ###############
+
+type MemoryUserStore struct {
+	m *memory
+}
+
+func (s *MemoryUserStore) Insert(ctx context.Context, u *User) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u.Name = strings.TrimSpace(u.Name)
+
+	for _, stored := range s.m.users {
+		if strings.EqualFold(stored.Name, u.Name) {
+			return 0, ErrDuplicate
+		}
+	}
+
+	s.m.lastUser++
+
+	u.ID = s.m.lastUser
+	u.Created = time.Now().UTC()
+
+	// Defaults of the table.
+	u.NotifyAssigned, u.NotifyOverdue, u.NotifyResolved = true, false, false
+
+	s.m.users[u.ID] = *u
+
+	return u.ID, nil
+}
+
+func (s *MemoryUserStore) Data(ctx context.Context, id int) (*User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[id]
+	if !ok {
+		return nil, ErrNoRows
+	}
+
+	return &u, nil
+}
+
+func (s *MemoryUserStore) GetByName(ctx context.Context, name string) (*User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, u := range s.m.users {
+		if strings.EqualFold(u.Name, strings.TrimSpace(name)) {
+			return &u, nil
+		}
+	}
+
+	return nil, ErrNoRows
+}
+
+func (s *MemoryUserStore) List(ctx context.Context) ([]*User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	users := []*User{}
+
+	for _, u := range s.m.users {
+		u := u
+		users = append(users, &u)
+	}
+
+	sort.Slice(users, func(a, b int) bool {
+		return users[a].Name < users[b].Name
+	})
+
+	return users, nil
+}
+
+// Same as UserStore.Subscribers().
+func (s *MemoryUserStore) Subscribers(ctx context.Context, n Notification) ([]*User, error) {
+	users, _ := s.List(ctx)
+	subscribers := []*User{}
+
+	for _, u := range users {
+		if u.Wants(n) {
+			subscribers = append(subscribers, u)
+		}
+	}
+
+	return subscribers, nil
+}
+
+func (s *MemoryUserStore) SetPreferences(ctx context.Context, u *User) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.users[u.ID]
+	if !ok {
+		return ErrNoRows
+	}
+
+	stored.Email = strings.TrimSpace(u.Email)
+	stored.NotifyAssigned = u.NotifyAssigned
+	stored.NotifyOverdue = u.NotifyOverdue
+	stored.NotifyResolved = u.NotifyResolved
+
+	if stored.Digest != u.Digest {
+		now := time.Now().UTC()
+		stored.Digest, stored.DigestSent = u.Digest, &now
+	}
+
+	s.m.users[u.ID] = stored
+
+	return nil
+}
+
+// Same as UserStore.DigestDue().
+func (s *MemoryUserStore) DigestDue(ctx context.Context, period string,
+	due time.Time) ([]*User, error) {
+
+	users, _ := s.List(ctx)
+	dues := []*User{}
+
+	for _, u := range users {
+		if u.Email != "" && u.Digest == period &&
+			(u.DigestSent == nil || u.DigestSent.Before(due)) {
+			dues = append(dues, u)
+		}
+	}
+
+	return dues, nil
+}
+
+func (s *MemoryUserStore) SetDigestSent(ctx context.Context, id int,
+	sent time.Time) error {
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[id]
+	if !ok {
+		return ErrNoRows
+	}
+
+	sent = sent.UTC()
+	u.DigestSent = &sent
+	s.m.users[id] = u
+
+	return nil
+}
+
+// Same as UserStore.SetTeam().
+func (s *MemoryUserStore) SetTeam(ctx context.Context, id int, team string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[id]
+	if !ok {
+		return ErrNoRows
+	}
+
+	u.Team = team
+	s.m.users[id] = u
+
+	return nil
+}
+
+// ####################
+// MemorySavedViewStore
+// ####################
+
+type MemorySavedViewStore struct {
+	m *memory
+}
+
+func (s *MemorySavedViewStore) Insert(ctx context.Context, v *SavedView) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	// Foreign keys
+	if _, ok := s.m.users[v.UserID]; !ok {
+		return 0, ErrNoRows
+	}
+
+	if _, ok := s.m.sources[v.SourceID]; !ok {
+		return 0, ErrNoRows
+	}
+
+	s.m.lastView++
+
+	v.ID = s.m.lastView
+	v.Created = time.Now().UTC()
+
+	s.m.views[v.ID] = *v
+
+	return v.ID, nil
+}
+
+func (s *MemorySavedViewStore) Data(ctx context.Context, id int) (*SavedView, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	v, ok := s.m.views[id]
+	if !ok {
+		return nil, ErrNoRows
+	}
+
+	return s.m.joinView(v), nil
+}
+
+// Same as SavedViewStore.ForUser().
+func (s *MemorySavedViewStore) ForUser(ctx context.Context, u *User) ([]*SavedView, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	views := []*SavedView{}
+
+	for _, v := range s.m.views {
+		owner := s.m.users[v.UserID]
+
+		if v.UserID == u.ID || (v.Shared && u.Team != "" && owner.Team == u.Team) {
+			views = append(views, s.m.joinView(v))
+		}
+	}
+
+	sort.Slice(views, func(a, b int) bool {
+		mineA, mineB := views[a].UserID == u.ID, views[b].UserID == u.ID
+		if mineA != mineB {
+			return mineA
+		}
+
+		return views[a].Name < views[b].Name
+	})
+
+	return views, nil
+}
+
+func (s *MemorySavedViewStore) Update(ctx context.Context, v *SavedView) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.views[v.ID]
+	if !ok || stored.UserID != v.UserID {
+		return ErrNoRows
+	}
+
+	stored.Name = v.Name
+	stored.Pinned = v.Pinned
+	stored.Shared = v.Shared
+
+	s.m.views[v.ID] = stored
+
+	return nil
+}
+
+func (s *MemorySavedViewStore) Delete(ctx context.Context, id, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.views[id]
+	if !ok || stored.UserID != userID {
+		return ErrNoRows
+	}
+
+	delete(s.m.views, id)
+
+	return nil
+}
+
+// ##############
+// MemorySLAStore
+// ##############
+
+type MemorySLAStore struct {
+	m *memory
+}
+
+func (s *MemorySLAStore) List(ctx context.Context) ([]*SLA, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	rules := []*SLA{}
+
+	for _, r := range s.m.slas {
+		r := r
+		r.Source = s.m.sources[r.SourceID].Name
+		rules = append(rules, &r)
+	}
+
+	sort.Slice(rules, func(a, b int) bool {
+		ra, rb := rules[a], rules[b]
+
+		if (ra.SourceID == 0) != (rb.SourceID == 0) {
+			return ra.SourceID == 0
+		}
+
+		if ra.Source != rb.Source {
+			return ra.Source < rb.Source
+		}
+
+		return ra.Priority < rb.Priority
+	})
+
+	return rules, nil
+}
+
+func (s *MemorySLAStore) Days(ctx context.Context, sourceID, priority int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	days := 0
+
+	for _, r := range s.m.slas {
+		if r.Priority != priority {
+			continue
+		}
+
+		if r.SourceID == sourceID && sourceID != 0 {
+			return r.Days, nil
+		}
+
+		if r.SourceID == 0 {
+			days = r.Days
+		}
+	}
+
+	return days, nil
+}
+
+func (s *MemorySLAStore) Set(ctx context.Context, r *SLA) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.sources[r.SourceID]; !ok && r.SourceID != 0 {
+		return ErrNoRows
+	}
+
+	for _, stored := range s.m.slas {
+		if stored.SourceID == r.SourceID && stored.Priority == r.Priority {
+			r.ID = stored.ID
+			s.m.slas[r.ID] = SLA{ID: r.ID, SourceID: r.SourceID,
+				Priority: r.Priority, Days: r.Days}
+
+			return nil
+		}
+	}
+
+	s.m.insertSLA(r)
+
+	return nil
+}
+
+func (s *MemorySLAStore) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	r, ok := s.m.slas[id]
+	if !ok || r.SourceID == 0 {
+		return ErrNoRows
+	}
+
+	delete(s.m.slas, id)
+
+	return nil
+}
+
+// Same as SLAStore.Stats().
+func (s *MemorySLAStore) Stats(ctx context.Context, from time.Time) ([]*SLAStat, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	day := today(time.Now())
+
+	type key struct {
+		source int
+		month  time.Time
+	}
+
+	stats := map[key]*SLAStat{}
+
+	for _, i := range s.m.infos {
+		if i.Target == nil || i.Target.Before(from) ||
+			(i.Resolved == nil && !i.Target.Before(day)) {
+			continue
+		}
+
+		k := key{i.SourceID, time.Date(i.Target.Year(), i.Target.Month(), 1,
+			0, 0, 0, 0, time.UTC)}
+
+		st, ok := stats[k]
+		if !ok {
+			st = &SLAStat{SourceID: k.source, Source: s.m.sources[k.source].Name,
+				Month: k.month}
+			stats[k] = st
+		}
+
+		st.Total++
+
+		if i.Resolved != nil && !i.Resolved.Truncate(24*time.Hour).After(*i.Target) {
+			st.OnTime++
+		}
+	}
+
+	list := []*SLAStat{}
+	for _, st := range stats {
+		list = append(list, st)
+	}
+
+	sort.Slice(list, func(a, b int) bool {
+		if !list[a].Month.Equal(list[b].Month) {
+			return list[a].Month.After(list[b].Month)
+		}
+
+		return list[a].Source < list[b].Source
+	})
+
+	return list, nil
+}
+
+// #################
+// MemoryOutboxStore
+// #################
+
+type MemoryOutboxStore struct {
+	m *memory
+}
+
+func (s *MemoryOutboxStore) Insert(ctx context.Context, e *Email) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.lastEmail++
+
+	e.ID = s.m.lastEmail
+	e.Created = time.Now().UTC()
+	e.NextAttempt = e.Created
+
+	s.m.outbox[e.ID] = *e
+
+	return e.ID, nil
+}
+
+// Same as OutboxStore.Pending().
+func (s *MemoryOutboxStore) Pending(ctx context.Context, maxAttempts, limit int) ([]*Email, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now().UTC()
+	emails := []*Email{}
+
+	for _, e := range s.m.outbox {
+		if e.Sent == nil && e.Attempts < maxAttempts && !e.NextAttempt.After(now) {
+			e := e
+			emails = append(emails, &e)
+		}
+	}
+
+	sort.Slice(emails, func(a, b int) bool {
+		if !emails[a].NextAttempt.Equal(emails[b].NextAttempt) {
+			return emails[a].NextAttempt.Before(emails[b].NextAttempt)
+		}
+
+		return emails[a].ID < emails[b].ID
+	})
+
+	if len(emails) > limit {
+		emails = emails[:limit]
+	}
+
+	return emails, nil
+}
+
+func (s *MemoryOutboxStore) MarkSent(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	e, ok := s.m.outbox[id]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	e.Sent = &now
+	e.Attempts++
+	e.LastError = ""
+
+	s.m.outbox[id] = e
+
+	return nil
+}
+
+func (s *MemoryOutboxStore) MarkFailed(ctx context.Context, id int, sendErr error,
+	next time.Time) error {
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	e, ok := s.m.outbox[id]
+	if !ok {
+		return nil
+	}
+
+	e.Attempts++
+	e.LastError = sendErr.Error()
+	e.NextAttempt = next.UTC()
+
+	s.m.outbox[id] = e
+
+	return nil
+}
+
+// ##################
+// MemoryWebhookStore
+// ##################
+
+type MemoryWebhookStore struct {
+	m *memory
+}
+
+func (s *MemoryWebhookStore) List(ctx context.Context) ([]*Webhook, error) {
+	return s.list(func(*Webhook) bool { return true }), nil
+}
+
+// Same as WebhookStore.Subscribed().
+func (s *MemoryWebhookStore) Subscribed(ctx context.Context, event string) ([]*Webhook, error) {
+	return s.list(func(w *Webhook) bool { return w.Wants(event) }), nil
+}
+
+func (s *MemoryWebhookStore) list(filter func(*Webhook) bool) []*Webhook {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	hooks := []*Webhook{}
+
+	for _, w := range s.m.hooks {
+		w := w
+		w.Events = append([]string{}, w.Events...)
+
+		if filter(&w) {
+			hooks = append(hooks, &w)
+		}
+	}
+
+	sort.Slice(hooks, func(a, b int) bool {
+		return hooks[a].ID < hooks[b].ID
+	})
+
+	return hooks
+}
+
+func (s *MemoryWebhookStore) Data(ctx context.Context, id int) (*Webhook, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	w, ok := s.m.hooks[id]
+	if !ok {
+		return nil, ErrNoRows
+	}
+
+	w.Events = append([]string{}, w.Events...)
+
+	return &w, nil
+}
+
+func (s *MemoryWebhookStore) Insert(ctx context.Context, w *Webhook) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.lastHook++
+
+	w.ID = s.m.lastHook
+	w.Created = time.Now().UTC()
+	w.Events = append([]string{}, w.Events...)
+
+	s.m.hooks[w.ID] = *w
+
+	return w.ID, nil
+}
+
+// Same as WebhookStore.Update().
+func (s *MemoryWebhookStore) Update(ctx context.Context, w *Webhook) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.hooks[w.ID]
+	if !ok {
+		return ErrNoRows
+	}
+
+	stored.URL = w.URL
+	stored.Events = append([]string{}, w.Events...)
+	stored.Active = w.Active
+
+	s.m.hooks[w.ID] = stored
+
+	return nil
+}
+
+// Same as WebhookStore.Delete(), the deliveries go with the webhook.
+func (s *MemoryWebhookStore) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.hooks[id]; !ok {
+		return ErrNoRows
+	}
+
+	delete(s.m.hooks, id)
+
+	for callID, d := range s.m.calls {
+		if d.WebhookID == id {
+			delete(s.m.calls, callID)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryWebhookStore) Queue(ctx context.Context, d *Delivery) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.queue(d), nil
+}
+
+// Same as WebhookStore.Redeliver().
+func (s *MemoryWebhookStore) Redeliver(ctx context.Context, id int) (*Delivery, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	d, ok := s.m.calls[id]
+	if !ok {
+		return nil, ErrNoRows
+	}
+
+	d = Delivery{WebhookID: d.WebhookID, Event: d.Event, Payload: d.Payload}
+	s.queue(&d)
+
+	return &d, nil
+}
+
+// queue() expects s.m.mu to be locked.
+func (s *MemoryWebhookStore) queue(d *Delivery) int {
+	s.m.lastCall++
+
+	d.ID = s.m.lastCall
+	d.Created = time.Now().UTC()
+	d.NextAttempt = d.Created
+
+	s.m.calls[d.ID] = *d
+
+	return d.ID
+}
+
+// Same as WebhookStore.Pending().
+func (s *MemoryWebhookStore) Pending(ctx context.Context, maxAttempts,
+	limit int) ([]*Delivery, error) {
+
+	now := time.Now().UTC()
+
+	deliveries := s.deliveries(func(d *Delivery, w Webhook) bool {
+		return d.Delivered == nil && d.Attempts < maxAttempts &&
+			!d.NextAttempt.After(now) && w.Active
+	})
+
+	sort.Slice(deliveries, func(a, b int) bool {
+		if !deliveries[a].NextAttempt.Equal(deliveries[b].NextAttempt) {
+			return deliveries[a].NextAttempt.Before(deliveries[b].NextAttempt)
+		}
+
+		return deliveries[a].ID < deliveries[b].ID
+	})
+
+	return deliveries[:min(limit, len(deliveries))], nil
+}
+
+// Same as WebhookStore.Deliveries().
+func (s *MemoryWebhookStore) Deliveries(ctx context.Context, webhookID,
+	limit int) ([]*Delivery, error) {
+
+	deliveries := s.deliveries(func(d *Delivery, w Webhook) bool {
+		return d.WebhookID == webhookID
+	})
+
+	sort.Slice(deliveries, func(a, b int) bool {
+		return deliveries[a].ID > deliveries[b].ID
+	})
+
+	return deliveries[:min(limit, len(deliveries))], nil
+}
+
+// deliveries() returns the deliveries matching the filter, with the URL and
+// the secret of their webhook.
+func (s *MemoryWebhookStore) deliveries(filter func(*Delivery, Webhook) bool) []*Delivery {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	deliveries := []*Delivery{}
+
+	for _, d := range s.m.calls {
+		d := d
+		w := s.m.hooks[d.WebhookID]
+		d.URL, d.Secret = w.URL, w.Secret
+
+		if filter(&d, w) {
+			deliveries = append(deliveries, &d)
+		}
+	}
+
+	return deliveries
+}
+
+func (s *MemoryWebhookStore) MarkDelivered(ctx context.Context, id, status int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	d, ok := s.m.calls[id]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	d.Delivered = &now
+	d.Attempts++
+	d.StatusCode = status
+	d.LastError = ""
+
+	s.m.calls[id] = d
+
+	return nil
+}
+
+func (s *MemoryWebhookStore) MarkFailed(ctx context.Context, id, status int,
+	sendErr error, next time.Time) error {
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	d, ok := s.m.calls[id]
+	if !ok {
+		return nil
+	}
+
+	d.Attempts++
+	d.StatusCode = status
+	d.LastError = sendErr.Error()
+	d.NextAttempt = next.UTC()
+
+	s.m.calls[id] = d
+
+	return nil
+}
+
+// ####################
+// MemoryEquipmentStore
+// ####################
+
+type MemoryEquipmentStore struct {
+	m *memory
+}
+
+// Same as EquipmentStore.List().
+func (s *MemoryEquipmentStore) List(ctx context.Context, sourceID int) ([]*Equipment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	items := []*Equipment{}
+
+	for _, e := range s.m.equipment {
+		if e.SourceID != sourceID {
+			continue
+		}
+
+		e := e
+
+		for _, i := range s.m.infos {
+			if i.EquipmentID != e.ID {
+				continue
+			}
+
+			e.NbCuratifs++
+
+			if i.Status != "résolu" && i.Status != "archivé" {
+				e.NbOpen++
+			}
+		}
+
+		items = append(items, &e)
+	}
+
+	sort.Slice(items, func(a, b int) bool {
+		if items[a].Bay != items[b].Bay {
+			return items[a].Bay < items[b].Bay
+		}
+
+		return strings.ToLower(items[a].Name) < strings.ToLower(items[b].Name)
+	})
+
+	return items, nil
+}
+
+func (s *MemoryEquipmentStore) Data(ctx context.Context, id int) (*Equipment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	e, ok := s.m.equipment[id]
+	if !ok {
+		return nil, ErrNoRows
+	}
+
+	return &e, nil
+}
+
+// Same as EquipmentStore.ByName().
+func (s *MemoryEquipmentStore) ByName(ctx context.Context, sourceID int,
+	name string) (*Equipment, error) {
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	name = strings.TrimSpace(name)
+
+	for _, e := range s.m.equipment {
+		if e.SourceID == sourceID && strings.EqualFold(e.Name, name) {
+			return &e, nil
+		}
+	}
+
+	return nil, ErrNoRows
+}
+
+// Like the foreign key, the source must exist.
+func (s *MemoryEquipmentStore) Insert(ctx context.Context, e *Equipment) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.sources[e.SourceID]; !ok {
+		return 0, ErrNoRows
+	}
+
+	if s.duplicate(e) {
+		return 0, ErrDuplicate
+	}
+
+	s.m.lastEquipment++
+
+	e.ID = s.m.lastEquipment
+	e.Created = time.Now().UTC()
+
+	s.m.equipment[e.ID] = *e
+
+	return e.ID, nil
+}
+
+func (s *MemoryEquipmentStore) Update(ctx context.Context, e *Equipment) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.equipment[e.ID]
+	if !ok {
+		return ErrNoRows
+	}
+
+	e.SourceID = stored.SourceID
+
+	if s.duplicate(e) {
+		return ErrDuplicate
+	}
+
+	stored.Name = e.Name
+	stored.Bay = e.Bay
+	stored.Type = e.Type
+	stored.Manufacturer = e.Manufacturer
+	stored.Serial = e.Serial
+	stored.Commissioned = e.Commissioned
+
+	s.m.equipment[e.ID] = stored
+
+	return nil
+}
+
+// duplicate() checks the unique index on the source and the name. The caller
+// holds the lock.
+func (s *MemoryEquipmentStore) duplicate(e *Equipment) bool {
+	for _, other := range s.m.equipment {
+		if other.ID != e.ID && other.SourceID == e.SourceID &&
+			strings.EqualFold(other.Name, e.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Like ON DELETE SET NULL, the curatifs lose their equipment.
+func (s *MemoryEquipmentStore) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.equipment[id]; !ok {
+		return ErrNoRows
+	}
+
+	delete(s.m.equipment, id)
+
+	for _, i := range s.m.infos {
+		if i.EquipmentID == id {
+			i.EquipmentID = 0
+			s.m.infos[i.ID] = i
+		}
+	}
+
+	return nil
+}
+
+// Same as EquipmentStore.History().
+func (s *MemoryEquipmentStore) History(ctx context.Context, id int) ([]*Info, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	infos := []*Info{}
+
+	for _, i := range s.m.sortedInfos() {
+		if i.EquipmentID == id {
+			i := i
+			infos = append(infos, &i)
+		}
+	}
+
+	sort.Slice(infos, func(a, b int) bool {
+		if !infos[a].Created.Equal(infos[b].Created) {
+			return infos[a].Created.After(infos[b].Created)
+		}
+
+		return infos[a].ID > infos[b].ID
+	})
+
+	return infos, nil
+}
+
+// #######
+// Helpers
+// #######
+
+// The helpers below expect m.mu to be locked by the caller.
+
+// insertInfo() behaves like the INSERT of InfoStore: the source must exist
+// and the info starts at version 1.
+func (m *memory) insertInfo(i *Info) (int, error) {
+	if _, ok := m.sources[i.SourceID]; !ok {
+		return 0, ErrNoRows
+	}
+
+	m.lastInfo++
+
+	i.ID = m.lastInfo
+	i.Version = 1
+	i.Created = time.Now().UTC()
+	i.Resolved = resolvedAt(i.Status, i.Resolved, i.Created)
+
+	m.infos[i.ID] = *i
+
+	return i.ID, nil
+}
+
+func (m *memory) insertSLA(r *SLA) {
+	m.lastSLA++
+
+	r.ID = m.lastSLA
+	m.slas[r.ID] = SLA{ID: r.ID, SourceID: r.SourceID, Priority: r.Priority,
+		Days: r.Days}
+}
+
+// sameDate() is true if both dates are nil, or equal. It's the IS NOT
+// DISTINCT FROM of PSQL.
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
+
+// sortedInfos() returns the infos ordered by id, like PSQL does most of the
+// time without ORDER BY.
+func (m *memory) sortedInfos() []Info {
+	infos := make([]Info, 0, len(m.infos))
+
+	for _, i := range m.infos {
+		infos = append(infos, i)
+	}
+
+	sort.Slice(infos, func(a, b int) bool {
+		return infos[a].ID < infos[b].ID
+	})
+
+	return infos
+}
+
+// archive() sets to "archivé" every resolved info matching the filter and
+// writes it in the history.
+func (m *memory) archive(now time.Time, filter func(Info) bool) []*Info {
+	archived := []*Info{}
+
+	for _, i := range m.sortedInfos() {
+		if i.Status != "résolu" || !filter(i) {
+			continue
+		}
+
+		i.Status = "archivé"
+		i.Updated = now
+		i.Version++
+
+		m.infos[i.ID] = i
+
+		m.history = append(m.history, historyRow{
+			InfoID:   i.ID,
+			SourceID: i.SourceID,
+			Action:   "archivé",
+			Detail:   i.Material,
+			Created:  now,
+		})
+
+		archived = append(archived, &Info{
+			ID:       i.ID,
+			SourceID: i.SourceID,
+			Material: i.Material,
+		})
+	}
+
+	return archived
+}
+
+// joinView() returns a copy of v with the owner and source names.
+func (m *memory) joinView(v SavedView) *SavedView {
+	v.Owner = m.users[v.UserID].Name
+	v.Source = m.sources[v.SourceID].Name
+
+	return &v
+}
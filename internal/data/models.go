@@ -0,0 +1,167 @@
+package data
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The handlers only know the interfaces below, so the PSQL stores can be
+// replaced by the in-memory ones (see memory.go) when there's no DB.
+
+// SourceRepository is implemented by SourceStore and MemorySourceStore.
+type SourceRepository interface {
+	GetAllActive(ctx context.Context) ([]*Source, error)
+	InfoSolved(ctx context.Context) ([]*Source, error)
+	Data(ctx context.Context, id int) (*Source, error)
+	Insert(ctx context.Context, src *Source) (int, error)
+	Delete(ctx context.Context, id int) error
+	Update(ctx context.Context, src *Source) error
+	Digest(ctx context.Context, from, to time.Time, limit int) ([]*Digest, error)
+}
+
+// InfoRepository is implemented by InfoStore and MemoryInfoStore.
+type InfoRepository interface {
+	ActiveInfo(ctx context.Context) ([]*Info, error)
+	OpenCounts(ctx context.Context) ([]*OpenCount, error)
+	Insert(ctx context.Context, i *Info) (int, error)
+	Data(ctx context.Context, id int) (*Info, error)
+	List(ctx context.Context, id int, f InfoFilters) ([]*Info, Metadata, error)
+	Delete(ctx context.Context, id int) error
+	Update(ctx context.Context, i *Info) error
+	ArchiveResolved(ctx context.Context, days int) ([]*Info, error)
+	ArchiveSource(ctx context.Context, id int) ([]*Info, error)
+	Search(ctx context.Context, f SearchFilters) ([]*SearchResult, error)
+	MarkOverdue(ctx context.Context) ([]*Info, error)
+	Unpushed(ctx context.Context, limit int) ([]*WorkItem, error)
+	SetWorkOrder(ctx context.Context, id int, workOrder string) error
+	Pushed(ctx context.Context) ([]*Info, error)
+	Recurring(ctx context.Context, f RecurringFilters) ([]*Recurrence, error)
+}
+
+// ImportRepository is used by CSV to send the imported infos.
+// It's implemented by ImportStore and MemoryImportStore.
+type ImportRepository interface {
+	SourceID(ctx context.Context, name string) (int, error)
+	InsertInfos(ctx context.Context, infos []*Info) (int, error)
+}
+
+// UserRepository is implemented by UserStore and MemoryUserStore.
+type UserRepository interface {
+	Insert(ctx context.Context, u *User) (int, error)
+	Data(ctx context.Context, id int) (*User, error)
+	GetByName(ctx context.Context, name string) (*User, error)
+	List(ctx context.Context) ([]*User, error)
+	SetTeam(ctx context.Context, id int, team string) error
+	Subscribers(ctx context.Context, n Notification) ([]*User, error)
+	SetPreferences(ctx context.Context, u *User) error
+	DigestDue(ctx context.Context, period string, due time.Time) ([]*User, error)
+	SetDigestSent(ctx context.Context, id int, sent time.Time) error
+}
+
+// SavedViewRepository is implemented by SavedViewStore and
+// MemorySavedViewStore.
+type SavedViewRepository interface {
+	Insert(ctx context.Context, v *SavedView) (int, error)
+	Data(ctx context.Context, id int) (*SavedView, error)
+	ForUser(ctx context.Context, u *User) ([]*SavedView, error)
+	Update(ctx context.Context, v *SavedView) error
+	Delete(ctx context.Context, id, userID int) error
+}
+
+// SLARepository is implemented by SLAStore and MemorySLAStore.
+type SLARepository interface {
+	List(ctx context.Context) ([]*SLA, error)
+	Days(ctx context.Context, sourceID, priority int) (int, error)
+	Set(ctx context.Context, r *SLA) error
+	Delete(ctx context.Context, id int) error
+	Stats(ctx context.Context, from time.Time) ([]*SLAStat, error)
+}
+
+// OutboxRepository is implemented by OutboxStore and MemoryOutboxStore.
+type OutboxRepository interface {
+	Insert(ctx context.Context, e *Email) (int, error)
+	Pending(ctx context.Context, maxAttempts, limit int) ([]*Email, error)
+	MarkSent(ctx context.Context, id int) error
+	MarkFailed(ctx context.Context, id int, sendErr error, next time.Time) error
+}
+
+// WebhookRepository is implemented by WebhookStore and MemoryWebhookStore.
+type WebhookRepository interface {
+	List(ctx context.Context) ([]*Webhook, error)
+	Subscribed(ctx context.Context, event string) ([]*Webhook, error)
+	Data(ctx context.Context, id int) (*Webhook, error)
+	Insert(ctx context.Context, w *Webhook) (int, error)
+	Update(ctx context.Context, w *Webhook) error
+	Delete(ctx context.Context, id int) error
+	Queue(ctx context.Context, d *Delivery) (int, error)
+	Redeliver(ctx context.Context, id int) (*Delivery, error)
+	Pending(ctx context.Context, maxAttempts, limit int) ([]*Delivery, error)
+	Deliveries(ctx context.Context, webhookID, limit int) ([]*Delivery, error)
+	MarkDelivered(ctx context.Context, id, status int) error
+	MarkFailed(ctx context.Context, id, status int, sendErr error, next time.Time) error
+}
+
+// EquipmentRepository is implemented by EquipmentStore and
+// MemoryEquipmentStore.
+type EquipmentRepository interface {
+	List(ctx context.Context, sourceID int) ([]*Equipment, error)
+	Data(ctx context.Context, id int) (*Equipment, error)
+	ByName(ctx context.Context, sourceID int, name string) (*Equipment, error)
+	Insert(ctx context.Context, e *Equipment) (int, error)
+	Update(ctx context.Context, e *Equipment) error
+	Delete(ctx context.Context, id int) error
+	History(ctx context.Context, id int) ([]*Info, error)
+}
+
+// Models groups every repository used by the app.
+type Models struct {
+	Sources  SourceRepository
+	Infos    InfoRepository
+	Imports  ImportRepository
+	Users    UserRepository
+	Views    SavedViewRepository
+	SLAs     SLARepository
+	Outbox   OutboxRepository
+	Webhooks WebhookRepository
+
+	Equipment EquipmentRepository
+}
+
+// NewModels() returns the repositories backed by PSQL.
+func NewModels(db *pgxpool.Pool, logger *slog.Logger) Models {
+	return Models{
+		Sources:  &SourceStore{DB: db, Logger: logger},
+		Infos:    &InfoStore{DB: db, Logger: logger},
+		Imports:  &ImportStore{DB: db},
+		Users:    &UserStore{DB: db},
+		Views:    &SavedViewStore{DB: db},
+		SLAs:     &SLAStore{DB: db},
+		Outbox:   &OutboxStore{DB: db},
+		Webhooks: &WebhookStore{DB: db},
+
+		Equipment: &EquipmentStore{DB: db},
+	}
+}
+
+// NewMemoryModels() returns repositories keeping everything in memory. They
+// behave like the PSQL ones and share the same data, so a source deleted from
+// Sources is also gone for Infos.
+func NewMemoryModels() Models {
+	m := newMemory()
+
+	return Models{
+		Sources:  &MemorySourceStore{m},
+		Infos:    &MemoryInfoStore{m},
+		Imports:  &MemoryImportStore{m},
+		Users:    &MemoryUserStore{m},
+		Views:    &MemorySavedViewStore{m},
+		SLAs:     &MemorySLAStore{m},
+		Outbox:   &MemoryOutboxStore{m},
+		Webhooks: &MemoryWebhookStore{m},
+
+		Equipment: &MemoryEquipmentStore{m},
+	}
+}
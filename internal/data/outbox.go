@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Email is a row of the outbox: a rendered email waiting to be sent. Kind is
+// the Notification it comes from.
+type Email struct {
+	ID          int
+	Recipient   string
+	Subject     string
+	Text        string
+	HTML        string
+	Kind        string
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	Sent        *time.Time
+	Created     time.Time
+}
+
+// OutboxStore makes the connexion between the mail worker and the outbox
+// table.
+type OutboxStore struct {
+	DB *pgxpool.Pool
+}
+
+// Insert() queues the email, to be sent as soon as possible.
+func (s *OutboxStore) Insert(ctx context.Context, e *Email) (int, error) {
+	query := `
+INSERT INTO outbox (recipient, subject, text_body, html_body, kind,
+                    next_attempt, created)
+VALUES ($1, $2, $3, $4, $5, $6, $6)
+  RETURNING id
+`
+
+	e.Created = time.Now().UTC()
+	e.NextAttempt = e.Created
+
+	args := []any{e.Recipient, e.Subject, e.Text, e.HTML, e.Kind, e.Created}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&e.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return e.ID, nil
+}
+
+// Pending() returns the emails to send now, the oldest first. The ones which
+// failed maxAttempts times are left in the table, with their last error.
+func (s *OutboxStore) Pending(ctx context.Context, maxAttempts, limit int) ([]*Email, error) {
+	query := `
+SELECT id, recipient, subject, text_body, html_body, kind, attempts,
+       next_attempt, last_error, created
+  FROM outbox
+ WHERE sent IS NULL AND
+       attempts < $1 AND
+       next_attempt <= $2
+ ORDER BY next_attempt ASC, id ASC
+ LIMIT $3
+`
+
+	rows, err := s.DB.Query(ctx, query, maxAttempts, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []*Email{}
+
+	for rows.Next() {
+		e := &Email{}
+
+		scan := []any{&e.ID, &e.Recipient, &e.Subject, &e.Text, &e.HTML,
+			&e.Kind, &e.Attempts, &e.NextAttempt, &e.LastError, &e.Created}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+func (s *OutboxStore) MarkSent(ctx context.Context, id int) error {
+	query := `
+UPDATE outbox
+   SET sent = $1, attempts = attempts + 1, last_error = ''
+ WHERE id = $2
+`
+
+	_, err := s.DB.Exec(ctx, query, time.Now().UTC(), id)
+
+	return err
+}
+
+// MarkFailed() records the error of an attempt, the email is sent again at
+// next.
+func (s *OutboxStore) MarkFailed(ctx context.Context, id int, sendErr error,
+	next time.Time) error {
+
+	query := `
+UPDATE outbox
+   SET attempts = attempts + 1, last_error = $1, next_attempt = $2
+ WHERE id = $3
+`
+
+	_, err := s.DB.Exec(ctx, query, sendErr.Error(), next.UTC(), id)
+
+	return err
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Recurrence is a group of infos of a source on the same equipment, or on the
+// same material for the infos without equipment. Label is the name of the
+// equipment or the normalized material, see NormalizeMaterial().
+type Recurrence struct {
+	SourceID    int
+	Source      string
+	EquipmentID int
+	Label       string
+	Infos       []*Info // newest first
+}
+
+// Open() returns the number of infos of the group not résolu nor archivé.
+func (r *Recurrence) Open() int {
+	n := 0
+
+	for _, i := range r.Infos {
+		if i.Status != "résolu" && i.Status != "archivé" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// RecurringFilters selects the groups returned by Recurring(): the ones
+// having at least Min infos created since From (every info if From is zero).
+// With OpenOnly, only the open infos are counted.
+type RecurringFilters struct {
+	From     time.Time
+	Min      int
+	OpenOnly bool
+}
+
+// NormalizeMaterial() lower-cases the material and collapses its spaces, so
+// "TR 1 " and "tr  1" are the same. It's the materialKey of the query.
+func NormalizeMaterial(material string) string {
+	return strings.ToLower(strings.Join(strings.Fields(material), " "))
+}
+
+// Same as NormalizeMaterial().
+const materialKey = `lower(btrim(regexp_replace(i.material, '\s+', ' ', 'g')))`
+
+// Recurring() returns the groups matching the filters, the largest first.
+func (s *InfoStore) Recurring(ctx context.Context, f RecurringFilters) ([]*Recurrence, error) {
+	query := `
+SELECT id, source_id, source, equipment_id, label, material, event, status,
+       priority, agent, created
+  FROM (SELECT i.id, i.source_id, s.name AS source,
+               COALESCE(i.equipment_id, 0) AS equipment_id,
+               COALESCE(e.name, ` + materialKey + `) AS label,
+               i.material, i.event, i.status, i.priority, i.agent, i.created,
+               COUNT(*) OVER (PARTITION BY i.source_id, i.equipment_id,
+                              COALESCE(e.name, ` + materialKey + `)) AS n
+          FROM info AS i
+               JOIN source AS s
+               ON s.id = i.source_id
+               LEFT JOIN equipment AS e
+               ON e.id = i.equipment_id
+         WHERE ($1::timestamp IS NULL OR i.created >= $1) AND
+               (NOT $2 OR i.status NOT IN ('résolu', 'archivé'))) AS g
+ WHERE n >= $3
+ ORDER BY n DESC, source ASC, label ASC, equipment_id ASC, created DESC,
+          id DESC
+`
+
+	args := []any{nullTime(f.From), f.OpenOnly, f.Min}
+
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []*Recurrence{}
+
+	var last *Recurrence
+
+	for rows.Next() {
+		i := &Info{}
+		r := &Recurrence{}
+
+		scan := []any{&i.ID, &i.SourceID, &r.Source, &r.EquipmentID,
+			&r.Label, &i.Material, &i.Event, &i.Status, &i.Priority,
+			&i.Agent, &i.Created}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		r.SourceID = i.SourceID
+		i.EquipmentID = r.EquipmentID
+
+		// The rows of a group follow each other.
+		if last == nil || last.SourceID != r.SourceID ||
+			last.EquipmentID != r.EquipmentID || last.Label != r.Label {
+
+			groups = append(groups, r)
+			last = r
+		}
+
+		last.Infos = append(last.Infos, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
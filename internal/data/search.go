@@ -0,0 +1,369 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Markers put around the matching words of SearchResult.Headline. They are
+// replaced by HTML tags once the headline has been escaped.
+const (
+	HighlightStart = "[[["
+	HighlightStop  = "]]]"
+)
+
+// SearchFilters are the criteria of a full-text search. Query uses the web
+// search syntax: "disjoncteur -poste", "\"défaut terre\"", "a or b".
+// A zero value disables the filter.
+type SearchFilters struct {
+	Query    string
+	SourceID int
+	Status   string
+	Priority int
+	Limit    int
+}
+
+// SearchResult is an info matching the search, ordered by Rank.
+type SearchResult struct {
+	ID       int       `json:"id"`
+	SourceID int       `json:"source_id"`
+	Source   string    `json:"source"`
+	Material string    `json:"material"`
+	Status   string    `json:"status"`
+	Priority int       `json:"priority"`
+	Created  time.Time `json:"created"`
+	Rank     float64   `json:"rank"`
+
+	// Extract of the info with the matching words between HighlightStart
+	// and HighlightStop.
+	Headline string `json:"headline"`
+}
+
+// Search() looks for the infos matching f.Query in material, event, detail,
+// agent and the comments (estimate, doneby), in that order of weight (see
+// migrations 000005 and 000015). Accents and plural forms are ignored.
+func (s *InfoStore) Search(ctx context.Context, f SearchFilters) ([]*SearchResult, error) {
+	query := `
+SELECT i.id, i.source_id, s.name, i.material, i.status, i.priority,
+       i.created,
+       ts_rank(i.search, q),
+       ts_headline('french_unaccent',
+                   concat_ws(' - ', i.material, i.event, i.detail,
+                             NULLIF(i.estimate, ''), NULLIF(i.doneby, '')), q,
+                   'StartSel="[[[", StopSel="]]]", MaxFragments=2, MaxWords=25, MinWords=8')
+  FROM info AS i
+       JOIN source AS s
+       ON i.source_id = s.id,
+       websearch_to_tsquery('french_unaccent', $1) AS q
+ WHERE ($1 = '' OR i.search @@ q) AND
+       ($2 = 0 OR i.source_id = $2) AND
+       ($3 = '' OR i.status = $3) AND
+       ($4 = 0 OR i.priority = $4)
+ ORDER BY 8 DESC, i.created DESC
+ LIMIT $5
+`
+
+	args := []any{f.Query, f.SourceID, f.Status, f.Priority, limit(f.Limit)}
+
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+
+	for rows.Next() {
+		r := &SearchResult{}
+
+		scan := []any{&r.ID, &r.SourceID, &r.Source, &r.Material, &r.Status,
+			&r.Priority, &r.Created, &r.Rank, &r.Headline}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Max number of results of a search.
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 200
+)
+
+func limit(n int) int {
+	if n <= 0 {
+		return DefaultSearchLimit
+	}
+
+	if n > MaxSearchLimit {
+		return MaxSearchLimit
+	}
+
+	return n
+}
+
+// Same as InfoStore.Search(). The words are compared once stemmed by stem(),
+// accents and case being ignored, and the stop words are left out like
+// french_unaccent does. A phrase only needs its words, in any order.
+func (s *MemoryInfoStore) Search(ctx context.Context, f SearchFilters) ([]*SearchResult, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	groups := parseQuery(f.Query)
+	results := []*SearchResult{}
+
+	// Like an empty tsquery, a query of stop words matches nothing.
+	if strings.TrimSpace(f.Query) != "" && len(groups) == 0 {
+		return results, nil
+	}
+
+	for _, i := range s.m.sortedInfos() {
+		if (f.SourceID != 0 && i.SourceID != f.SourceID) ||
+			(f.Status != "" && i.Status != f.Status) ||
+			(f.Priority != 0 && i.Priority != f.Priority) {
+			continue
+		}
+
+		// Same weights as the search column: A=1, B=0.4, C=0.2, D=0.1.
+		fields := []struct {
+			stems  []string
+			weight float64
+		}{
+			{stems(i.Material), 1}, {stems(i.Event), 0.4},
+			{stems(i.Detail), 0.2}, {stems(i.Agent), 0.1},
+			{stems(i.Estimate), 0.1}, {stems(i.Doneby), 0.1},
+		}
+
+		rank := 0.0
+		matched := 0
+
+		for _, group := range groups {
+			found := false
+
+			for _, t := range group {
+				n := 0
+
+				for _, field := range fields {
+					c := count(field.stems, t.stem)
+					n += c
+
+					if !t.not {
+						rank += field.weight * float64(c)
+					}
+				}
+
+				found = found || (n > 0) != t.not
+			}
+
+			if found {
+				matched++
+			}
+		}
+
+		if matched < len(groups) {
+			continue
+		}
+
+		// Like concat_ws(), the empty comments are left out.
+		text := i.Material + " - " + i.Event + " - " + i.Detail
+
+		for _, comment := range []string{i.Estimate, i.Doneby} {
+			if comment != "" {
+				text += " - " + comment
+			}
+		}
+
+		results = append(results, &SearchResult{
+			ID:       i.ID,
+			SourceID: i.SourceID,
+			Source:   s.m.sources[i.SourceID].Name,
+			Material: i.Material,
+			Status:   i.Status,
+			Priority: i.Priority,
+			Created:  i.Created,
+			Rank:     rank,
+			Headline: highlight(text, groups),
+		})
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].Rank != results[b].Rank {
+			return results[a].Rank > results[b].Rank
+		}
+
+		return results[a].Created.After(results[b].Created)
+	})
+
+	if n := limit(f.Limit); len(results) > n {
+		results = results[:n]
+	}
+
+	return results, nil
+}
+
+// searchTerm is a stemmed word of the query, not being set if the word
+// excludes the infos having it.
+type searchTerm struct {
+	stem string
+	not  bool
+}
+
+// parseQuery() reads the syntax of websearch_to_tsquery(). Every group must
+// match, and a group matches if one of its terms does: the words are all
+// required, "or" puts two words in the same group and a leading "-" excludes
+// the word. The quotes are ignored.
+func parseQuery(query string) [][]searchTerm {
+	groups := [][]searchTerm{}
+	or := false
+
+	for _, token := range strings.Fields(strings.ReplaceAll(query, `"`, " ")) {
+		if strings.EqualFold(token, "or") {
+			or = len(groups) > 0
+			continue
+		}
+
+		not := strings.HasPrefix(token, "-")
+
+		for _, w := range strings.FieldsFunc(fold(token), isSeparator) {
+			if frenchStopWords[w] {
+				continue
+			}
+
+			t := searchTerm{stem: stem(w), not: not}
+
+			if or {
+				groups[len(groups)-1] = append(groups[len(groups)-1], t)
+				or = false
+			} else {
+				groups = append(groups, []searchTerm{t})
+			}
+		}
+
+		or = false
+	}
+
+	return groups
+}
+
+// fold() removes the accents and the case, like unaccent() and lower().
+func fold(s string) string {
+	var b strings.Builder
+
+	for _, r := range norm.NFD.String(s) {
+		// Combining diacritical marks.
+		if r >= 0x300 && r <= 0x36f {
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return strings.ToLower(b.String())
+}
+
+// stem() is a light version of the French stemmer of PSQL: the plural mark,
+// then the final "e" are removed from the folded word w. So "fuites",
+// "fuite" and "fuit" are the same word, as they are for french_unaccent.
+func stem(w string) string {
+	r := []rune(w)
+
+	if len(r) > 3 && (r[len(r)-1] == 's' || r[len(r)-1] == 'x') {
+		r = r[:len(r)-1]
+	}
+
+	for len(r) > 3 && r[len(r)-1] == 'e' {
+		r = r[:len(r)-1]
+	}
+
+	return string(r)
+}
+
+// stems() returns the stems of the words of text.
+func stems(text string) []string {
+	words := strings.FieldsFunc(fold(text), isSeparator)
+
+	for n, w := range words {
+		words[n] = stem(w)
+	}
+
+	return words
+}
+
+// count() counts the occurrences of stem in stems.
+func count(stems []string, stem string) int {
+	n := 0
+
+	for _, s := range stems {
+		if s == stem {
+			n++
+		}
+	}
+
+	return n
+}
+
+// highlight() puts the markers around the words of text matching one of the
+// terms which aren't excluded.
+func highlight(text string, groups [][]searchTerm) string {
+	var b strings.Builder
+
+	for _, w := range strings.Fields(text) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+
+		match := false
+
+		for _, part := range stems(w) {
+			for _, group := range groups {
+				for _, t := range group {
+					match = match || (!t.not && t.stem == part)
+				}
+			}
+		}
+
+		if match {
+			b.WriteString(HighlightStart + w + HighlightStop)
+		} else {
+			b.WriteString(w)
+		}
+	}
+
+	return b.String()
+}
+
+func isSeparator(r rune) bool {
+	return strings.ContainsRune(" \t\n.,;:!?()[]{}'\"-/", r)
+}
+
+// frenchStopWords are the words of the french stop list of PSQL without
+// accent: unaccent runs first, so the others are searched like any word.
+var frenchStopWords = map[string]bool{
+	"au": true, "aux": true, "avec": true, "ce": true, "ces": true,
+	"dans": true, "de": true, "des": true, "du": true, "elle": true,
+	"en": true, "et": true, "eux": true, "il": true, "ils": true,
+	"je": true, "la": true, "le": true, "les": true, "leur": true,
+	"lui": true, "ma": true, "mais": true, "me": true, "mes": true,
+	"moi": true, "mon": true, "ne": true, "nos": true, "notre": true,
+	"nous": true, "on": true, "ou": true, "par": true, "pas": true,
+	"pour": true, "qu": true, "que": true, "qui": true, "sa": true,
+	"se": true, "ses": true, "son": true, "sur": true, "ta": true,
+	"te": true, "tes": true, "toi": true, "ton": true, "tu": true,
+	"un": true, "une": true, "vos": true, "votre": true, "vous": true,
+	"c": true, "d": true, "j": true, "l": true, "m": true, "n": true,
+	"s": true, "t": true, "y": true, "est": true, "sont": true,
+}
@@ -0,0 +1,265 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SLA gives the number of days to fix an info of a priority. SourceID is 0
+// for the default rules, otherwise the rule overrides the default of the
+// priority for that source.
+type SLA struct {
+	ID       int    `json:"id"`
+	SourceID int    `json:"source_id,omitempty"`
+	Source   string `json:"source,omitempty"` // set by List()
+	Priority int    `json:"priority"`
+	Days     int    `json:"days"`
+}
+
+// SLATarget() returns the target date of an info created at created with
+// days to be fixed, nil if there's no rule (days is 0).
+func SLATarget(created time.Time, days int) *time.Time {
+	if days <= 0 {
+		return nil
+	}
+
+	day := time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0,
+		time.UTC)
+	day = day.AddDate(0, 0, days)
+
+	return &day
+}
+
+// SLAStat counts the infos of a source whose target falls in Month and whose
+// outcome is known: either resolved, or still open with the target past.
+type SLAStat struct {
+	SourceID int       `json:"source_id"`
+	Source   string    `json:"source"`
+	Month    time.Time `json:"month"`
+	Total    int       `json:"total"`
+	OnTime   int       `json:"on_time"`
+}
+
+// Percent() returns the percentage of infos resolved on time, 100 if there's
+// none.
+func (s *SLAStat) Percent() int {
+	if s.Total == 0 {
+		return 100
+	}
+
+	return s.OnTime * 100 / s.Total
+}
+
+// Breached() is the number of infos resolved late or still open past their
+// target.
+func (s *SLAStat) Breached() int {
+	return s.Total - s.OnTime
+}
+
+// SumSLAStats() adds the stats having the same key, in the order of their
+// first appearance. Exemple, the totals per source:
+//
+//	SumSLAStats(stats, func(s *SLAStat) SLAStat {
+//		return SLAStat{SourceID: s.SourceID, Source: s.Source}
+//	})
+func SumSLAStats(stats []*SLAStat, key func(*SLAStat) SLAStat) []*SLAStat {
+	sums := []*SLAStat{}
+	index := map[SLAStat]*SLAStat{}
+
+	for _, s := range stats {
+		k := key(s)
+
+		sum, ok := index[k]
+		if !ok {
+			sum = &SLAStat{}
+			*sum = k
+			index[k] = sum
+			sums = append(sums, sum)
+		}
+
+		sum.Total += s.Total
+		sum.OnTime += s.OnTime
+	}
+
+	return sums
+}
+
+// SLAStore makes the connexion between the handlers and the sla table.
+type SLAStore struct {
+	DB *pgxpool.Pool
+}
+
+// List() returns the default rules, then the overrides ordered by source
+// name, each by priority.
+func (s *SLAStore) List(ctx context.Context) ([]*SLA, error) {
+	query := `
+SELECT r.id, COALESCE(r.source_id, 0), COALESCE(s.name, ''), r.priority,
+       r.days
+  FROM sla AS r
+       LEFT JOIN source AS s
+       ON r.source_id = s.id
+ ORDER BY r.source_id IS NOT NULL, s.name ASC, r.priority ASC
+`
+
+	rows, err := s.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*SLA{}
+
+	for rows.Next() {
+		r := &SLA{}
+
+		err := rows.Scan(&r.ID, &r.SourceID, &r.Source, &r.Priority, &r.Days)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// Days() returns the days of the priority for the source: its override if
+// any, the default otherwise. 0 means there's no rule.
+func (s *SLAStore) Days(ctx context.Context, sourceID, priority int) (int, error) {
+	query := `
+SELECT days
+  FROM sla
+ WHERE priority = $2 AND
+       (source_id = $1 OR source_id IS NULL)
+ ORDER BY source_id NULLS LAST
+ LIMIT 1
+`
+
+	var days int
+
+	err := s.DB.QueryRow(ctx, query, sourceID, priority).Scan(&days)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return days, nil
+}
+
+// Set() creates the rule of r.SourceID and r.Priority, or changes its days if
+// it already exists. r.ID is set on success.
+func (s *SLAStore) Set(ctx context.Context, r *SLA) error {
+	// Each kind of rule has its own unique index, see migration 000008.
+	query := `
+INSERT INTO sla (source_id, priority, days)
+VALUES ($1, $2, $3)
+    ON CONFLICT (source_id, priority) WHERE source_id IS NOT NULL
+    DO UPDATE SET days = EXCLUDED.days
+  RETURNING id
+`
+
+	var source *int
+
+	if r.SourceID == 0 {
+		query = `
+INSERT INTO sla (source_id, priority, days)
+VALUES ($1, $2, $3)
+    ON CONFLICT (priority) WHERE source_id IS NULL
+    DO UPDATE SET days = EXCLUDED.days
+  RETURNING id
+`
+	} else {
+		source = &r.SourceID
+	}
+
+	err := s.DB.QueryRow(ctx, query, source, r.Priority, r.Days).Scan(&r.ID)
+	if err != nil {
+		// foreign_key_violation: the source doesn't exist.
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrNoRows
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Delete() only deletes the overrides, the default rules can only be
+// changed.
+func (s *SLAStore) Delete(ctx context.Context, id int) error {
+	query := `
+DELETE FROM sla
+ WHERE id = $1 AND source_id IS NOT NULL
+`
+
+	result, err := s.DB.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// Stats() returns the SLAStat of each source and month since from, the
+// most recent months first.
+func (s *SLAStore) Stats(ctx context.Context, from time.Time) ([]*SLAStat, error) {
+	query := `
+SELECT s.id, s.name, date_trunc('month', i.target)::date,
+       COUNT(*),
+       COUNT(*) FILTER (WHERE i.resolved::date <= i.target)
+  FROM info AS i
+       JOIN source AS s
+       ON i.source_id = s.id
+ WHERE i.target IS NOT NULL AND
+       i.target >= $1 AND
+       (i.resolved IS NOT NULL OR i.target < $2::date)
+ GROUP BY s.id, 3
+ ORDER BY 3 DESC, s.name ASC
+`
+
+	rows, err := s.DB.Query(ctx, query, from, today(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []*SLAStat{}
+
+	for rows.Next() {
+		st := &SLAStat{}
+
+		scan := []any{&st.SourceID, &st.Source, &st.Month, &st.Total,
+			&st.OnTime}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, st)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
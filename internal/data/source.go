@@ -3,10 +3,11 @@ package data
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -14,13 +15,52 @@ type Source struct {
 	ID         int    `json:"-"`
 	Name       string `json:"name"`
 	NbCuratifs int    `json:"nb_curatifs"`
+	NbOverdue  int    `json:"nb_overdue"` // set by GetAllActive()
 	CodeGMAO   string `json:"code_GMAO"`
 	SID        int    `json:"-"`
 
+	// Days before a resolved info gets archived, 0 to never archive them.
+	// nil means the global value is used.
+	ArchiveAfter *int `json:"archive_after"`
+
+	// Metadata shown by sourceView. VoltageKV is 0 when unknown, Latitude
+	// and Longitude are both nil or both set.
+	VoltageKV int      `json:"voltage_kv,omitempty"`
+	Address   string   `json:"address,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Team      string   `json:"team,omitempty"`
+	Notes     string   `json:"notes,omitempty"`
+
 	Created time.Time `json:"-"`
+}
+
+// sourceError converts the unique violations of the source table.
+func sourceError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		if pgErr.ConstraintName == "source_code_gmao_idx" {
+			return ErrDuplicateCode
+		}
+
+		return ErrDuplicate
+	}
 
-	InfoLog  *log.Logger `json:"-"`
-	ErrorLog *log.Logger `json:"-"`
+	return err
+}
+
+// SourceStore makes the connexion between the handlers and the source table.
+// Every method returns new Source values so it can be shared by concurrent
+// requests.
+type SourceStore struct {
+	DB     *pgxpool.Pool
+	Logger *slog.Logger
+}
+
+// ArchiveNever() is true if the resolved infos of the source are never
+// archived by ArchiveResolved().
+func (src *Source) ArchiveNever() bool {
+	return src.ArchiveAfter != nil && *src.ArchiveAfter == 0
 }
 
 // Needed for Menu graph
@@ -28,16 +68,16 @@ func (jsrc *Source) SourceJSON() ([]byte, error) {
 	return nil, nil
 }
 
-// GetAllSource() fetch for each active Source, it's id, name, code_GMAO, the total
-// number of info !archivé and !résolu.
-func (src *Source) GetAllActive(conn *pgxpool.Conn) ([]*Source, error) {
-	ctx := context.Background()
-
+// GetAllActive() fetch for each Source, it's id, name, code_GMAO, the total
+// number of info !archivé and !résolu, and how many of them are overdue.
+func (s *SourceStore) GetAllActive(ctx context.Context) ([]*Source, error) {
 	query := `
-SELECT s.id
-       s.name
-       s.code_GMAO
-       COUNT(i.status) FILTER (WHERE i.status <> 'archivé' AND i.status <> 'résolu') 
+SELECT s.id,
+       s.name,
+       COALESCE(s.code_GMAO, ''),
+       COUNT(i.status) FILTER (WHERE i.status <> 'archivé' AND i.status <> 'résolu'),
+       COUNT(i.status) FILTER (WHERE i.status <> 'archivé' AND i.status <> 'résolu' AND
+                                     i.target < $1::date)
   FROM source AS s
        LEFT JOIN info AS i
        ON i.source_id = s.id
@@ -45,9 +85,9 @@ SELECT s.id
  ORDER BY name ASC
 `
 
-	rows, err := conn.Query(ctx, query)
+	rows, err := s.DB.Query(ctx, query, today(time.Now()))
 	if err != nil {
-		src.ErrorLog.Println("Could not fetch data!")
+		s.Logger.Error("could not fetch sources", "error", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -55,15 +95,16 @@ SELECT s.id
 	sources := []*Source{}
 
 	for rows.Next() {
-		s := &Source{}
+		src := &Source{}
 
-		args := []any{s.ID, s.Name, s.CodeGMAO, s.NbCuratifs}
+		args := []any{&src.ID, &src.Name, &src.CodeGMAO, &src.NbCuratifs,
+			&src.NbOverdue}
 
 		err := rows.Scan(args...)
 		if err != nil {
 			return nil, err
 		}
-		sources = append(sources, s)
+		sources = append(sources, src)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -73,23 +114,21 @@ SELECT s.id
 	return sources, nil
 }
 
-// CuratifSolved() fetch for each Source it's id, name, code_GMAO and NbCuratifs
+// InfoSolved() fetch for each Source it's id, name, code_GMAO and NbCuratifs
 // where it's info it's solved. Again this is primarily used for graphs.
-func (src *Source) InfoSolved(conn *pgxpool.Conn) ([]*Source, error) {
-	ctx := context.Background()
-
+func (s *SourceStore) InfoSolved(ctx context.Context) ([]*Source, error) {
 	query := `
 SELECT s.id,
        s.name,
-       s.code_GMAO,
+       COALESCE(s.code_GMAO, ''),
        COUNT(i.status) FILTER (WHERE i.status = 'résolu')
   FROM source AS s
-       LEFT JOIN info AS i 
+       LEFT JOIN info AS i
        ON i.source_id = s.id
  GROUP BY s.id
  ORDER BY name ASC
 `
-	rows, err := conn.Query(ctx, query)
+	rows, err := s.DB.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -98,16 +137,16 @@ SELECT s.id,
 	sources := []*Source{}
 
 	for rows.Next() {
-		s := &Source{}
+		src := &Source{}
 
-		args := []any{s.ID, s.Name, s.CodeGMAO, s.NbCuratifs}
+		args := []any{&src.ID, &src.Name, &src.CodeGMAO, &src.NbCuratifs}
 
 		err := rows.Scan(args...)
 		if err != nil {
 			return nil, err
 		}
 
-		sources = append(sources, s)
+		sources = append(sources, src)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -117,20 +156,22 @@ SELECT s.id,
 	return sources, nil
 }
 
-func (src *Source) Data(id int, conn *pgxpool.Conn) (*Source, error) {
-	ctx := context.Background()
-
+func (s *SourceStore) Data(ctx context.Context, id int) (*Source, error) {
 	query := `
-SELECT id, name, created
+SELECT id, name, created, archive_after,
+       COALESCE(code_GMAO, ''), COALESCE(voltage_kv, 0), address, latitude,
+       longitude, team, notes
   FROM source
  WHERE id = $1
 `
 
-	s := &Source{}
+	src := &Source{}
 
-	args := []any{s.ID, s.Name, s.Created}
+	args := []any{&src.ID, &src.Name, &src.Created, &src.ArchiveAfter,
+		&src.CodeGMAO, &src.VoltageKV, &src.Address, &src.Latitude,
+		&src.Longitude, &src.Team, &src.Notes}
 
-	err := conn.QueryRow(ctx, query, id).Scan(args...)
+	err := s.DB.QueryRow(ctx, query, id).Scan(args...)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrNoRows
@@ -139,58 +180,80 @@ SELECT id, name, created
 		return nil, err
 	}
 
-	return s, nil
+	return src, nil
 }
 
-// Make connexion and attempt to insert Source data to DB
-// If failed then return 0 as value.
-func (src *Source) Insert(name string, conn *pgxpool.Conn) (int, error) {
-	ctx := context.Background()
-
+// Attempt to insert Source data to DB. src.ID and src.Created are set on
+// success. ErrDuplicate is returned if the name is taken and ErrDuplicateCode
+// if the GMAO code is.
+func (s *SourceStore) Insert(ctx context.Context, src *Source) (int, error) {
 	query := `
-INSERT INTO source (name, created)
-VALUES ($1, $2)
+INSERT INTO source (name, archive_after, code_GMAO, voltage_kv, address,
+                    latitude, longitude, team, notes, created)
+VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, 0), $5, $6, $7, $8, $9,
+        $10)
   RETURNING id
 `
 
-	args := []any{name, time.Now().UTC()}
-	err := conn.QueryRow(ctx, query, args...).Scan(&src.ID)
+	src.Created = time.Now().UTC()
+
+	args := []any{src.Name, src.ArchiveAfter, src.CodeGMAO, src.VoltageKV,
+		src.Address, src.Latitude, src.Longitude, src.Team, src.Notes,
+		src.Created}
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&src.ID)
 	if err != nil {
-		return 0, nil
+		return 0, sourceError(err)
 	}
 
 	return src.ID, nil
 }
 
-// Make connexion to PSQL and attempt to delete the source choosed with id.
+// Attempt to delete the source choosed with id.
 // It only deletes if source is empty. (No info affiliated)
-func (src *Source) Delete(id int, conn *pgxpool.Conn) error {
-	ctx := context.Background()
+func (s *SourceStore) Delete(ctx context.Context, id int) error {
 	query := `
 DELETE FROM source
  WHERE id = $1
 `
 
-	_, err := conn.Exec(ctx, query, id)
+	result, err := s.DB.Exec(ctx, query, id)
 	if err != nil {
+		// foreign_key_violation: info rows still reference the source.
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrSourceNotEmpty
+		}
+
 		return err
 	}
 
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
 	return nil
 }
 
-// Make connexion to PSQL and attempt to update choosen data.
-func (src *Source) Update(id int, conn *pgxpool.Conn) error {
-	ctx := context.Background()
-
+// Attempt to update choosen data. Same errors as Insert().
+func (s *SourceStore) Update(ctx context.Context, src *Source) error {
 	query := `
 UPDATE source
-    SET name = $1
- WHERE id = $2
+    SET name = $1, archive_after = $2, code_GMAO = NULLIF($3, ''),
+        voltage_kv = NULLIF($4, 0), address = $5, latitude = $6,
+        longitude = $7, team = $8, notes = $9
+ WHERE id = $10
 `
-	_, err := conn.Exec(ctx, query, src.Name, id)
+
+	args := []any{src.Name, src.ArchiveAfter, src.CodeGMAO, src.VoltageKV,
+		src.Address, src.Latitude, src.Longitude, src.Team, src.Notes, src.ID}
+
+	result, err := s.DB.Exec(ctx, query, args...)
 	if err != nil {
-		return err
+		return sourceError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
 	}
 
 	return nil
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type User struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+
+	// Set by the reverse proxy, see SetTeam().
+	Team string `json:"team"`
+
+	// Emails the user wants to receive, see Wants().
+	NotifyAssigned bool `json:"notify_assigned"`
+	NotifyOverdue  bool `json:"notify_overdue"`
+	NotifyResolved bool `json:"notify_resolved"`
+
+	// Summary of the sources by email: "", DigestDaily or DigestWeekly.
+	Digest     string     `json:"digest"`
+	DigestSent *time.Time `json:"-"`
+
+	Created time.Time `json:"-"`
+}
+
+// Periods of the digests.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Notification is a kind of email sent to the users. Its value is the name of
+// the mailer template, and the kind of the outbox rows.
+type Notification string
+
+const (
+	// Sent to the agent of an info once it's assigned.
+	NotifyAssigned Notification = "info_assigned"
+
+	// Sent to the planners.
+	NotifyOverdue  Notification = "info_overdue"
+	NotifyResolved Notification = "info_resolved"
+)
+
+// Wants() is true if the user has an email and chose to receive n.
+func (u *User) Wants(n Notification) bool {
+	if u.Email == "" {
+		return false
+	}
+
+	switch n {
+	case NotifyAssigned:
+		return u.NotifyAssigned
+	case NotifyOverdue:
+		return u.NotifyOverdue
+	case NotifyResolved:
+		return u.NotifyResolved
+	}
+
+	return false
+}
+
+const userColumns = `
+SELECT id, name, email, team, notify_assigned, notify_overdue,
+       notify_resolved, digest, digest_sent, created
+  FROM users
+`
+
+// scan returns the destinations of userColumns.
+func (u *User) scan() []any {
+	return []any{&u.ID, &u.Name, &u.Email, &u.Team, &u.NotifyAssigned,
+		&u.NotifyOverdue, &u.NotifyResolved, &u.Digest, &u.DigestSent,
+		&u.Created}
+}
+
+// UserStore makes the connexion between the handlers and the users table.
+type UserStore struct {
+	DB *pgxpool.Pool
+}
+
+// Attempt to insert a new user. The name must be unique, otherwise
+// ErrDuplicate is returned.
+func (s *UserStore) Insert(ctx context.Context, u *User) (int, error) {
+	query := `
+INSERT INTO users (name, email, team, created)
+VALUES ($1, $2, $3, $4)
+  RETURNING id, notify_assigned, notify_overdue, notify_resolved
+`
+
+	u.Created = time.Now().UTC()
+
+	args := []any{strings.TrimSpace(u.Name), u.Email, u.Team, u.Created}
+
+	// The notifications get the defaults of the table.
+	scan := []any{&u.ID, &u.NotifyAssigned, &u.NotifyOverdue, &u.NotifyResolved}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(scan...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, ErrDuplicate
+		}
+
+		return 0, err
+	}
+
+	return u.ID, nil
+}
+
+func (s *UserStore) Data(ctx context.Context, id int) (*User, error) {
+	query := userColumns + `
+ WHERE id = $1
+`
+
+	return s.get(ctx, query, id)
+}
+
+// GetByName() fetch the user by its name, case insensitive.
+func (s *UserStore) GetByName(ctx context.Context, name string) (*User, error) {
+	query := userColumns + `
+ WHERE lower(name) = lower($1)
+`
+
+	return s.get(ctx, query, strings.TrimSpace(name))
+}
+
+func (s *UserStore) get(ctx context.Context, query string, arg any) (*User, error) {
+	u := &User{}
+
+	err := s.DB.QueryRow(ctx, query, arg).Scan(u.scan()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRows
+		}
+
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (s *UserStore) List(ctx context.Context) ([]*User, error) {
+	query := userColumns + `
+ ORDER BY name ASC
+`
+
+	return s.list(ctx, query)
+}
+
+// Subscribers() returns the users who want to receive n.
+func (s *UserStore) Subscribers(ctx context.Context, n Notification) ([]*User, error) {
+	query := userColumns + `
+ WHERE email <> '' AND
+       CASE $1
+       WHEN 'info_assigned' THEN notify_assigned
+       WHEN 'info_overdue' THEN notify_overdue
+       WHEN 'info_resolved' THEN notify_resolved
+       ELSE false
+       END
+ ORDER BY name ASC
+`
+
+	return s.list(ctx, query, string(n))
+}
+
+func (s *UserStore) list(ctx context.Context, query string,
+	args ...any) ([]*User, error) {
+
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		u := &User{}
+
+		err := rows.Scan(u.scan()...)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SetTeam() changes the team of the user. The team comes from the reverse
+// proxy at each request, it's only written when it changed.
+func (s *UserStore) SetTeam(ctx context.Context, id int, team string) error {
+	query := `
+UPDATE users
+   SET team = $1
+ WHERE id = $2
+`
+
+	result, err := s.DB.Exec(ctx, query, team, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// DigestDue() returns the users wanting the digest of period whose last one
+// was sent before due.
+func (s *UserStore) DigestDue(ctx context.Context, period string,
+	due time.Time) ([]*User, error) {
+
+	query := userColumns + `
+ WHERE email <> '' AND
+       digest = $1 AND
+       (digest_sent IS NULL OR digest_sent < $2)
+ ORDER BY name ASC
+`
+
+	return s.list(ctx, query, period, due.UTC())
+}
+
+// SetDigestSent() records when the digest of the user was queued.
+func (s *UserStore) SetDigestSent(ctx context.Context, id int,
+	sent time.Time) error {
+
+	query := `
+UPDATE users
+   SET digest_sent = $1
+ WHERE id = $2
+`
+
+	result, err := s.DB.Exec(ctx, query, sent.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// SetPreferences() changes the email of the user, the notifications and the
+// digest wanted. Choosing another digest counts as sent now, so the first
+// one covers a whole period.
+func (s *UserStore) SetPreferences(ctx context.Context, u *User) error {
+	query := `
+UPDATE users
+   SET email = $1, notify_assigned = $2, notify_overdue = $3,
+       notify_resolved = $4, digest = $5,
+       digest_sent = CASE WHEN digest <> $5 THEN $6 ELSE digest_sent END
+ WHERE id = $7
+`
+
+	args := []any{strings.TrimSpace(u.Email), u.NotifyAssigned,
+		u.NotifyOverdue, u.NotifyResolved, u.Digest, time.Now().UTC(), u.ID}
+
+	result, err := s.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
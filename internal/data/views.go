@@ -0,0 +1,173 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SavedView is a named set of filters of the sourceView page. Query is the
+// query string of the filters (status=affecté&priority=1...).
+type SavedView struct {
+	ID       int    `json:"id"`
+	UserID   int    `json:"-"`
+	SourceID int    `json:"source_id"`
+	Name     string `json:"name"`
+	Query    string `json:"query"`
+
+	// A pinned view is displayed on the home page of its owner, and of the
+	// team too if it's shared.
+	Pinned bool `json:"pinned"`
+	Shared bool `json:"shared"`
+
+	// Names of the owner and the source, set by the reads.
+	Owner  string `json:"owner"`
+	Source string `json:"source"`
+
+	// Number of infos matching the view, set by the handlers.
+	Count int `json:"count"`
+
+	Created time.Time `json:"-"`
+}
+
+// SavedViewStore makes the connexion between the handlers and the saved_view
+// table.
+type SavedViewStore struct {
+	DB *pgxpool.Pool
+}
+
+// Insert() sets v.ID and v.Created on success.
+func (s *SavedViewStore) Insert(ctx context.Context, v *SavedView) (int, error) {
+	query := `
+INSERT INTO saved_view (user_id, source_id, name, query, pinned, shared,
+                        created)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+  RETURNING id
+`
+
+	v.Created = time.Now().UTC()
+
+	args := []any{v.UserID, v.SourceID, v.Name, v.Query, v.Pinned, v.Shared,
+		v.Created}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&v.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.ID, nil
+}
+
+const savedViewColumns = `
+SELECT v.id, v.user_id, v.source_id, v.name, v.query, v.pinned, v.shared,
+       u.name, s.name, v.created
+  FROM saved_view AS v
+       JOIN users AS u
+       ON v.user_id = u.id
+       JOIN source AS s
+       ON v.source_id = s.id
+`
+
+func (s *SavedViewStore) Data(ctx context.Context, id int) (*SavedView, error) {
+	query := savedViewColumns + `
+ WHERE v.id = $1
+`
+
+	views, err := s.list(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(views) == 0 {
+		return nil, ErrNoRows
+	}
+
+	return views[0], nil
+}
+
+// ForUser() returns the views of the user, then the views shared by the
+// other users of the same team.
+func (s *SavedViewStore) ForUser(ctx context.Context, u *User) ([]*SavedView, error) {
+	query := savedViewColumns + `
+ WHERE v.user_id = $1 OR
+       (v.shared AND $2 <> '' AND u.team = $2)
+ ORDER BY v.user_id <> $1, v.name ASC
+`
+
+	return s.list(ctx, query, u.ID, u.Team)
+}
+
+func (s *SavedViewStore) list(ctx context.Context, query string,
+	args ...any) ([]*SavedView, error) {
+
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := []*SavedView{}
+
+	for rows.Next() {
+		v := &SavedView{}
+
+		scan := []any{&v.ID, &v.UserID, &v.SourceID, &v.Name, &v.Query,
+			&v.Pinned, &v.Shared, &v.Owner, &v.Source, &v.Created}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		views = append(views, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return views, nil
+}
+
+// Update() changes the name, pinned and shared of a view. Only its owner
+// (v.UserID) can do it, ErrNoRows is returned otherwise.
+func (s *SavedViewStore) Update(ctx context.Context, v *SavedView) error {
+	query := `
+UPDATE saved_view
+   SET name = $1, pinned = $2, shared = $3
+ WHERE id = $4 AND user_id = $5
+`
+
+	args := []any{v.Name, v.Pinned, v.Shared, v.ID, v.UserID}
+
+	result, err := s.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// Delete() only deletes the view if it belongs to userID.
+func (s *SavedViewStore) Delete(ctx context.Context, id, userID int) error {
+	query := `
+DELETE FROM saved_view
+ WHERE id = $1 AND user_id = $2
+`
+
+	result, err := s.DB.Exec(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,379 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Events sent to the webhooks.
+const (
+	EventInfoCreated       = "info.created"
+	EventInfoUpdated       = "info.updated"
+	EventInfoStatusChanged = "info.status_changed"
+	EventInfoDeleted       = "info.deleted"
+	EventSourceCreated     = "source.created"
+	EventSourceUpdated     = "source.updated"
+	EventSourceDeleted     = "source.deleted"
+)
+
+// WebhookEvents lists every event, in the order of the forms.
+var WebhookEvents = []string{
+	EventInfoCreated,
+	EventInfoUpdated,
+	EventInfoStatusChanged,
+	EventInfoDeleted,
+	EventSourceCreated,
+	EventSourceUpdated,
+	EventSourceDeleted,
+}
+
+// Webhook is an URL called on the events it subscribed to, every event if
+// Events is empty.
+type Webhook struct {
+	ID      int
+	URL     string
+	Secret  string
+	Events  []string
+	Active  bool
+	Created time.Time
+}
+
+// Wants() is true if the webhook is active and subscribed to event.
+func (w *Webhook) Wants(event string) bool {
+	if !w.Active {
+		return false
+	}
+
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delivery is a call of a webhook. URL and Secret come from the webhook.
+// Payload is the JSON body, signed when sent.
+type Delivery struct {
+	ID          int
+	WebhookID   int
+	URL         string
+	Secret      string
+	Event       string
+	Payload     string
+	Attempts    int
+	NextAttempt time.Time
+	StatusCode  int // last HTTP status received, 0 if none
+	LastError   string
+	Delivered   *time.Time
+	Created     time.Time
+}
+
+// WebhookStore makes the connexion between the handlers, the delivery worker
+// and the webhook and webhook_delivery tables.
+type WebhookStore struct {
+	DB *pgxpool.Pool
+}
+
+const webhookColumns = `
+SELECT id, url, secret, events, active, created
+  FROM webhook
+`
+
+func (s *WebhookStore) List(ctx context.Context) ([]*Webhook, error) {
+	query := webhookColumns + `
+ ORDER BY id ASC
+`
+
+	return s.list(ctx, query)
+}
+
+// Subscribed() returns the active webhooks wanting event.
+func (s *WebhookStore) Subscribed(ctx context.Context, event string) ([]*Webhook, error) {
+	query := webhookColumns + `
+ WHERE active AND
+       (events = '{}' OR $1 = ANY(events))
+ ORDER BY id ASC
+`
+
+	return s.list(ctx, query, event)
+}
+
+func (s *WebhookStore) list(ctx context.Context, query string,
+	args ...any) ([]*Webhook, error) {
+
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []*Webhook{}
+
+	for rows.Next() {
+		w := &Webhook{}
+
+		err := rows.Scan(&w.ID, &w.URL, &w.Secret, &w.Events, &w.Active,
+			&w.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		hooks = append(hooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+func (s *WebhookStore) Data(ctx context.Context, id int) (*Webhook, error) {
+	query := webhookColumns + `
+ WHERE id = $1
+`
+
+	w := &Webhook{}
+
+	err := s.DB.QueryRow(ctx, query, id).Scan(&w.ID, &w.URL, &w.Secret,
+		&w.Events, &w.Active, &w.Created)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRows
+		}
+
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (s *WebhookStore) Insert(ctx context.Context, w *Webhook) (int, error) {
+	query := `
+INSERT INTO webhook (url, secret, events, active, created)
+VALUES ($1, $2, $3, $4, $5)
+  RETURNING id
+`
+
+	w.Created = time.Now().UTC()
+
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+
+	args := []any{w.URL, w.Secret, w.Events, w.Active, w.Created}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&w.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return w.ID, nil
+}
+
+// Update() changes the URL, the events and the state of the webhook. The
+// secret never changes.
+func (s *WebhookStore) Update(ctx context.Context, w *Webhook) error {
+	query := `
+UPDATE webhook
+   SET url = $1, events = $2, active = $3
+ WHERE id = $4
+`
+
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+
+	result, err := s.DB.Exec(ctx, query, w.URL, w.Events, w.Active, w.ID)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// Delete() deletes the webhook and its deliveries.
+func (s *WebhookStore) Delete(ctx context.Context, id int) error {
+	query := `
+DELETE FROM webhook
+ WHERE id = $1
+`
+
+	result, err := s.DB.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// Queue() adds a delivery, to be sent as soon as possible.
+func (s *WebhookStore) Queue(ctx context.Context, d *Delivery) (int, error) {
+	query := `
+INSERT INTO webhook_delivery (webhook_id, event, payload, next_attempt,
+                              created)
+VALUES ($1, $2, $3, $4, $4)
+  RETURNING id
+`
+
+	d.Created = time.Now().UTC()
+	d.NextAttempt = d.Created
+
+	err := s.DB.QueryRow(ctx, query, d.WebhookID, d.Event, d.Payload,
+		d.Created).Scan(&d.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.ID, nil
+}
+
+// Redeliver() queues a copy of the delivery id, the log keeps both. It
+// returns the new delivery, or ErrNoRows.
+func (s *WebhookStore) Redeliver(ctx context.Context, id int) (*Delivery, error) {
+	query := `
+INSERT INTO webhook_delivery (webhook_id, event, payload, next_attempt,
+                              created)
+SELECT webhook_id, event, payload, $2, $2
+  FROM webhook_delivery
+ WHERE id = $1
+  RETURNING id, webhook_id, event, payload, next_attempt, created
+`
+
+	d := &Delivery{}
+
+	scan := []any{&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.NextAttempt,
+		&d.Created}
+
+	err := s.DB.QueryRow(ctx, query, id, time.Now().UTC()).Scan(scan...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRows
+		}
+
+		return nil, err
+	}
+
+	return d, nil
+}
+
+const deliveryColumns = `
+SELECT d.id, d.webhook_id, w.url, w.secret, d.event, d.payload, d.attempts,
+       d.next_attempt, d.status_code, d.last_error, d.delivered, d.created
+  FROM webhook_delivery AS d
+       JOIN webhook AS w
+       ON d.webhook_id = w.id
+`
+
+// Pending() returns the deliveries to send now, the oldest first. Those of
+// the disabled webhooks wait until they're enabled again.
+func (s *WebhookStore) Pending(ctx context.Context, maxAttempts,
+	limit int) ([]*Delivery, error) {
+
+	query := deliveryColumns + `
+ WHERE d.delivered IS NULL AND
+       d.attempts < $1 AND
+       d.next_attempt <= $2 AND
+       w.active
+ ORDER BY d.next_attempt ASC, d.id ASC
+ LIMIT $3
+`
+
+	return s.deliveries(ctx, query, maxAttempts, time.Now().UTC(), limit)
+}
+
+// Deliveries() returns the last deliveries of the webhook, the most recent
+// first.
+func (s *WebhookStore) Deliveries(ctx context.Context, webhookID,
+	limit int) ([]*Delivery, error) {
+
+	query := deliveryColumns + `
+ WHERE d.webhook_id = $1
+ ORDER BY d.id DESC
+ LIMIT $2
+`
+
+	return s.deliveries(ctx, query, webhookID, limit)
+}
+
+func (s *WebhookStore) deliveries(ctx context.Context, query string,
+	args ...any) ([]*Delivery, error) {
+
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+
+	for rows.Next() {
+		d := &Delivery{}
+
+		scan := []any{&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.Event,
+			&d.Payload, &d.Attempts, &d.NextAttempt, &d.StatusCode,
+			&d.LastError, &d.Delivered, &d.Created}
+
+		err := rows.Scan(scan...)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// MarkDelivered() records the successful attempt of the delivery.
+func (s *WebhookStore) MarkDelivered(ctx context.Context, id, status int) error {
+	query := `
+UPDATE webhook_delivery
+   SET delivered = $1, attempts = attempts + 1, status_code = $2,
+       last_error = ''
+ WHERE id = $3
+`
+
+	_, err := s.DB.Exec(ctx, query, time.Now().UTC(), status, id)
+
+	return err
+}
+
+// MarkFailed() records the error of an attempt, status being 0 when there
+// was no response. The delivery is sent again at next.
+func (s *WebhookStore) MarkFailed(ctx context.Context, id, status int,
+	sendErr error, next time.Time) error {
+
+	query := `
+UPDATE webhook_delivery
+   SET attempts = attempts + 1, status_code = $1, last_error = $2,
+       next_attempt = $3
+ WHERE id = $4
+`
+
+	_, err := s.DB.Exec(ctx, query, status, sendErr.Error(), next.UTC(), id)
+
+	return err
+}
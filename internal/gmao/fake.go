@@ -0,0 +1,72 @@
+package gmao
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Fake is a Connector keeping the work orders in memory, for tests and
+// local development. Work orders start "en attente", SetStatus() plays the
+// GMAO.
+type Fake struct {
+	mu     sync.Mutex
+	last   int
+	orders map[string]WorkOrder
+
+	// Requests received by Push(), in order.
+	Requests []WorkRequest
+}
+
+func NewFake() *Fake {
+	return &Fake{orders: make(map[string]WorkOrder)}
+}
+
+func (c *Fake) Push(ctx context.Context, wr *WorkRequest) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last++
+
+	id := fmt.Sprintf("FAKE-%d", c.last)
+
+	c.orders[id] = WorkOrder{ID: id, Status: "en attente"}
+	c.Requests = append(c.Requests, *wr)
+
+	return id, nil
+}
+
+func (c *Fake) Pull(ctx context.Context, ids []string) ([]*WorkOrder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	orders := []*WorkOrder{}
+
+	for _, id := range ids {
+		if o, ok := c.orders[id]; ok {
+			orders = append(orders, &o)
+		}
+	}
+
+	return orders, nil
+}
+
+// SetStatus() changes the work order id, status being a GMAO status. It
+// returns ErrUnknownStatus, or an error if the work order doesn't exist.
+func (c *Fake) SetStatus(id, status, doneBy string) error {
+	s, err := Status(status)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.orders[id]; !ok {
+		return fmt.Errorf("gmao: unknown work order %s", id)
+	}
+
+	c.orders[id] = WorkOrder{ID: id, Status: s, DoneBy: doneBy}
+
+	return nil
+}
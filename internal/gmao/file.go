@@ -0,0 +1,154 @@
+package gmao
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FileDrop is the Connector of a GMAO exchanging CSV files, comma separated
+// with a header line:
+//
+//   - Push() writes one file per work request in outDir, named after its
+//     reference (EC-42.csv): reference,site,material,event,detail,priority,
+//     agent,target. The reference is the ID of the work order.
+//   - Pull() reads every *.csv file of inDir, in the order of their names:
+//     id,status,done_by. When an ID appears more than once, the last line
+//     wins. The files are left in place, the GMAO manages them.
+type FileDrop struct {
+	outDir string
+	inDir  string
+}
+
+func NewFileDrop(outDir, inDir string) *FileDrop {
+	return &FileDrop{outDir: outDir, inDir: inDir}
+}
+
+var requestHeader = []string{"reference", "site", "material", "event",
+	"detail", "priority", "agent", "target"}
+
+func (c *FileDrop) Push(ctx context.Context, wr *WorkRequest) (string, error) {
+	target := ""
+	if wr.Target != nil {
+		target = wr.Target.Format("2006-01-02")
+	}
+
+	record := []string{wr.Reference, wr.Site, wr.Material, wr.Event,
+		wr.Detail, strconv.Itoa(wr.Priority), wr.Agent, target}
+
+	// Written aside then renamed, so the GMAO never reads half a file.
+	tmp, err := os.CreateTemp(c.outDir, ".work-request-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := csv.NewWriter(tmp)
+	w.Write(requestHeader)
+	w.Write(record)
+	w.Flush()
+
+	err = errors.Join(w.Error(), tmp.Close())
+	if err != nil {
+		return "", err
+	}
+
+	name := filepath.Join(c.outDir, wr.Reference+".csv")
+
+	err = os.Rename(tmp.Name(), name)
+	if err != nil {
+		return "", err
+	}
+
+	return wr.Reference, nil
+}
+
+func (c *FileDrop) Pull(ctx context.Context, ids []string) ([]*WorkOrder, error) {
+	files, err := filepath.Glob(filepath.Join(c.inDir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	byID := map[string]*WorkOrder{}
+
+	for _, name := range files {
+		err := readStatuses(name, wanted, byID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	orders := []*WorkOrder{}
+
+	for _, id := range ids {
+		if o, ok := byID[id]; ok {
+			orders = append(orders, o)
+		}
+	}
+
+	return orders, nil
+}
+
+// readStatuses() adds the work orders of the file which are wanted to byID.
+func readStatuses(name string, wanted map[string]bool,
+	byID map[string]*WorkOrder) error {
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+
+	lines, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("gmao: %s: %w", filepath.Base(name), err)
+	}
+
+	for n, line := range lines {
+		// Header.
+		if n == 0 {
+			continue
+		}
+
+		if len(line) < 2 {
+			return fmt.Errorf("gmao: %s line %d: expected id,status,done_by",
+				filepath.Base(name), n+1)
+		}
+
+		id := strings.TrimSpace(line[0])
+		if !wanted[id] {
+			continue
+		}
+
+		status, err := Status(line[1])
+		if err != nil {
+			return fmt.Errorf("%w %q (%s line %d)", err, line[1],
+				filepath.Base(name), n+1)
+		}
+
+		o := &WorkOrder{ID: id, Status: status}
+		if len(line) > 2 {
+			o.DoneBy = strings.TrimSpace(line[2])
+		}
+
+		byID[id] = o
+	}
+
+	return nil
+}
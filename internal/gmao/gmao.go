@@ -0,0 +1,79 @@
+// Package gmao connects E-Curatif to the GMAO (the maintenance management
+// system): the new curatifs are pushed as work requests, and the status of
+// their work orders is pulled back.
+//
+// Every Connector speaks in E-Curatif terms. The GMAO statuses are mapped
+// with Status(), the work orders are known by the ID the GMAO gave them, and
+// the sites by the code_GMAO of the sources.
+package gmao
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownStatus is returned by Status() for a GMAO status without
+// equivalent.
+var ErrUnknownStatus = errors.New("gmao: unknown status")
+
+// WorkRequest is a curatif pushed to the GMAO.
+type WorkRequest struct {
+	// Reference of the curatif, "EC-42" for the info 42. The GMAO keeps it
+	// with the work order.
+	Reference string     `json:"reference"`
+	Site      string     `json:"site"` // code_GMAO of the source
+	Material  string     `json:"material"`
+	Event     string     `json:"event"`
+	Detail    string     `json:"detail"`
+	Priority  int        `json:"priority"`
+	Agent     string     `json:"agent,omitempty"`
+	Target    *time.Time `json:"-"`
+	Created   time.Time  `json:"-"`
+}
+
+// WorkOrder is the state of a work request in the GMAO. Status is an
+// E-Curatif status ("en attente", "affecté" or "résolu").
+type WorkOrder struct {
+	ID     string
+	Status string
+	DoneBy string
+}
+
+// Connector is implemented by HTTP, FileDrop and Fake.
+type Connector interface {
+	// Push() creates the work request and returns the ID of its work order.
+	Push(ctx context.Context, wr *WorkRequest) (string, error)
+
+	// Pull() returns the state of the work orders. The IDs the GMAO doesn't
+	// know are left out.
+	Pull(ctx context.Context, ids []string) ([]*WorkOrder, error)
+}
+
+// Reference() returns the WorkRequest.Reference of the info id.
+func Reference(id int) string {
+	return "EC-" + strconv.Itoa(id)
+}
+
+// statuses maps the GMAO statuses, lower case, to the E-Curatif ones.
+var statuses = map[string]string{
+	"open":        "en attente",
+	"new":         "en attente",
+	"waiting":     "en attente",
+	"assigned":    "affecté",
+	"in_progress": "affecté",
+	"done":        "résolu",
+	"closed":      "résolu",
+}
+
+// Status() returns the E-Curatif status of the GMAO status s.
+func Status(s string) (string, error) {
+	status, ok := statuses[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return "", ErrUnknownStatus
+	}
+
+	return status, nil
+}
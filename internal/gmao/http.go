@@ -0,0 +1,139 @@
+package gmao
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTP is the Connector of a GMAO with a JSON API:
+//
+//	POST {url}/work-requests
+//	     {"reference": "EC-42", "site": "P123", "target": "2024-05-02", ...}
+//	  => 201 {"id": "OT-1234"}
+//
+//	GET  {url}/work-orders?ids=OT-1234,OT-1235
+//	  => 200 {"work_orders": [{"id": "OT-1234", "status": "done",
+//	                           "done_by": "J. Martin"}]}
+//
+// Requests carry the token as "Authorization: Bearer {token}" when set.
+type HTTP struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewHTTP(baseURL, token string, timeout time.Duration) *HTTP {
+	return &HTTP{
+		url:    strings.TrimRight(baseURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *HTTP) Push(ctx context.Context, wr *WorkRequest) (string, error) {
+	// The target is a date, like in the API of E-Curatif.
+	body := struct {
+		*WorkRequest
+		Target string `json:"target,omitempty"`
+	}{WorkRequest: wr}
+
+	if wr.Target != nil {
+		body.Target = wr.Target.Format("2006-01-02")
+	}
+
+	var out struct {
+		ID string `json:"id"`
+	}
+
+	err := c.do(ctx, http.MethodPost, "/work-requests", body, &out)
+	if err != nil {
+		return "", err
+	}
+
+	if out.ID == "" {
+		return "", fmt.Errorf("gmao: no work order ID for %s", wr.Reference)
+	}
+
+	return out.ID, nil
+}
+
+func (c *HTTP) Pull(ctx context.Context, ids []string) ([]*WorkOrder, error) {
+	var out struct {
+		WorkOrders []struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+			DoneBy string `json:"done_by"`
+		} `json:"work_orders"`
+	}
+
+	path := "/work-orders?ids=" + url.QueryEscape(strings.Join(ids, ","))
+
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []*WorkOrder{}
+
+	for _, o := range out.WorkOrders {
+		status, err := Status(o.Status)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q (work order %s)", err, o.Status, o.ID)
+		}
+
+		orders = append(orders, &WorkOrder{ID: o.ID, Status: status,
+			DoneBy: o.DoneBy})
+	}
+
+	return orders, nil
+}
+
+// do() sends in as JSON, if not nil, and decodes the response in out.
+func (c *HTTP) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+
+	if in != nil {
+		js, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("gmao: %s %s: %s %s", method, path, resp.Status,
+			strings.TrimSpace(string(msg)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,192 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+)
+
+// Each template defines the "subject", "plainBody" and "htmlBody" templates.
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// Message is a rendered email, ready to be queued then sent.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends the messages to an SMTP server. Without username, no
+// authentication is done: that's the case of the local stand-ins like
+// cmd/smtpsink.
+type Mailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+// New() returns a Mailer for the server at host:port. sender is the From
+// header, exemple: "E-Curatif <no-reply@exemple.fr>".
+func New(host string, port int, username, password, sender string) *Mailer {
+	m := &Mailer{
+		addr:   net.JoinHostPort(host, strconv.Itoa(port)),
+		sender: sender,
+	}
+
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m
+}
+
+// Render() executes the templates of templateFile with data.
+// Exemple: Render("info_assigned.tmpl", info)
+func Render(templateFile string, data any) (*Message, error) {
+	msg := &Message{}
+
+	// The subject and the text are executed with text/template, so the
+	// accents and quotes aren't escaped.
+	text, err := textTemplate.New("email").ParseFS(templateFS,
+		"templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = text.ExecuteTemplate(buf, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+
+	err = text.ExecuteTemplate(buf, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Text = strings.TrimLeft(buf.String(), "\n")
+
+	html, err := template.New("email").ParseFS(templateFS,
+		"templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	buf.Reset()
+
+	err = html.ExecuteTemplate(buf, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.HTML = strings.TrimLeft(buf.String(), "\n")
+
+	return msg, nil
+}
+
+// Send() sends msg to recipient as a multipart/alternative email, with the
+// text and the HTML versions. recipient is an RFC 5322 address, exemple:
+// "Dupont <dupont@exemple.fr>".
+func (m *Mailer) Send(recipient string, msg *Message) error {
+	from, err := mail.ParseAddress(m.sender)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", m.sender, err)
+	}
+
+	to, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", recipient, err)
+	}
+
+	body, err := build(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, from.Address, []string{to.Address},
+		body)
+}
+
+// build() writes the headers and the two parts of the email. The addresses
+// are written back by net/mail: the names are quoted or encoded, and nothing
+// of the original strings, like a line break, ends up in the headers.
+func build(from, to *mail.Address, msg *Message) ([]byte, error) {
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/alternative; boundary="` + boundary + `"`,
+	}
+
+	for _, h := range headers {
+		buf.WriteString(h + "\r\n")
+	}
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	}
+
+	for _, p := range parts {
+		fmt.Fprintf(buf, "\r\n--%s\r\n", boundary)
+		fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", p.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		w := quotedprintable.NewWriter(buf)
+
+		_, err := w.Write([]byte(p.content))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Fprintf(buf, "\r\n--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
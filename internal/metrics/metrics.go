@@ -0,0 +1,351 @@
+// Package metrics is a small exporter writing the Prometheus text format.
+// It only supports what the app needs: counters and histograms with labels,
+// plus collect functions called at each scrape for gauges read elsewhere
+// (pool stats, DB counts...).
+//
+// See: https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds. Same as the
+// official client.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds every metric exposed by the app, in registration order.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// WriteTo() writes every metric in the Prometheus text format.
+func (reg *Registry) WriteTo(out io.Writer) (int64, error) {
+	reg.mu.Lock()
+	metrics := append([]metric{}, reg.metrics...)
+	reg.mu.Unlock()
+
+	w := &Writer{buf: bufio.NewWriter(out)}
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+
+	err := w.buf.Flush()
+
+	return w.n, err
+}
+
+func (reg *Registry) register(m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.metrics = append(reg.metrics, m)
+}
+
+// ##########
+// CounterVec
+// ##########
+
+// CounterVec is a counter with one value per set of label values.
+type CounterVec struct {
+	desc
+
+	mu     sync.Mutex
+	values map[string]*sample
+}
+
+// Counter() creates and registers a new CounterVec.
+func (reg *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, labels: labels},
+		values: make(map[string]*sample),
+	}
+
+	reg.register(c)
+
+	return c
+}
+
+// Inc() adds 1 to the counter with the label values given in the same order
+// as the labels.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := strings.Join(labelValues, "\xff")
+
+	s, ok := c.values[key]
+	if !ok {
+		s = &sample{labelValues: labelValues}
+		c.values[key] = s
+	}
+
+	s.value += v
+}
+
+func (c *CounterVec) write(w *Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w.Header(c.name, c.help, "counter")
+
+	for _, s := range sortedSamples(c.values) {
+		w.Sample(c.name, c.labelPairs(s.labelValues), s.value)
+	}
+}
+
+// ############
+// HistogramVec
+// ############
+
+// HistogramVec is a histogram with one set of buckets per set of label
+// values.
+type HistogramVec struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64 // one per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// Histogram() creates and registers a new HistogramVec. buckets must be
+// sorted, DefBuckets is used if nil.
+func (reg *Registry) Histogram(name, help string, buckets []float64,
+	labels ...string) *HistogramVec {
+
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+
+	reg.register(h)
+
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := strings.Join(labelValues, "\xff")
+
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{
+			labelValues: labelValues,
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = hist
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hist.counts[i]++
+			break
+		}
+	}
+
+	hist.count++
+	hist.sum += v
+}
+
+func (h *HistogramVec) write(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w.Header(h.name, h.help, "histogram")
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		hist := h.values[k]
+		labels := h.labelPairs(hist.labelValues)
+
+		var cumulative uint64
+
+		for i, upper := range h.buckets {
+			cumulative += hist.counts[i]
+			le := append(append([]string{}, labels...), "le", formatFloat(upper))
+			w.Sample(h.name+"_bucket", le, float64(cumulative))
+		}
+
+		inf := append(append([]string{}, labels...), "le", "+Inf")
+		w.Sample(h.name+"_bucket", inf, float64(hist.count))
+		w.Sample(h.name+"_sum", labels, hist.sum)
+		w.Sample(h.name+"_count", labels, float64(hist.count))
+	}
+}
+
+// #######
+// Collect
+// #######
+
+// CollectFunc is called at each scrape and writes its own metrics with w.
+type CollectFunc func(w *Writer)
+
+type collector struct {
+	fn CollectFunc
+}
+
+func (c collector) write(w *Writer) {
+	c.fn(w)
+}
+
+// Collect() registers a function called at each scrape. Used for values the
+// app doesn't own, like the pool stats.
+func (reg *Registry) Collect(fn CollectFunc) {
+	reg.register(collector{fn})
+}
+
+// ######
+// Writer
+// ######
+
+// Writer writes metric lines in the Prometheus text format.
+type Writer struct {
+	buf *bufio.Writer
+	n   int64
+}
+
+// Header() writes the HELP and TYPE lines, it must come before the samples
+// of the metric.
+func (w *Writer) Header(name, help, typ string) {
+	w.printf("# HELP %s %s\n", name, escape(help, false))
+	w.printf("# TYPE %s %s\n", name, typ)
+}
+
+// Sample() writes one value. labels is a list of name/value pairs.
+// Exemple: w.Sample("ecuratif_open", []string{"source", "Poste A"}, 3)
+func (w *Writer) Sample(name string, labels []string, value float64) {
+	w.printf("%s", name)
+
+	if len(labels) > 0 {
+		w.printf("{")
+
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.printf(",")
+			}
+
+			w.printf("%s=\"%s\"", labels[i], escape(labels[i+1], true))
+		}
+
+		w.printf("}")
+	}
+
+	w.printf(" %s\n", formatFloat(value))
+}
+
+func (w *Writer) printf(format string, args ...any) {
+	n, _ := fmt.Fprintf(w.buf, format, args...)
+	w.n += int64(n)
+}
+
+// #######
+// Helpers
+// #######
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// labelPairs() zips the label names with their values.
+func (d desc) labelPairs(values []string) []string {
+	pairs := make([]string, 0, 2*len(d.labels))
+
+	for i, l := range d.labels {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+
+		pairs = append(pairs, l, v)
+	}
+
+	return pairs
+}
+
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+func sortedSamples(values map[string]*sample) []*sample {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	samples := make([]*sample, 0, len(keys))
+	for _, k := range keys {
+		samples = append(samples, values[k])
+	}
+
+	return samples
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escape() escapes backslashes and line feeds, and double quotes for label
+// values.
+func escape(s string, quotes bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+
+	if quotes {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+
+	return s
+}
@@ -0,0 +1,350 @@
+// Package migrate applies the versioned SQL files of the migrations package.
+// The current state of the DB is kept in the schema_migrations table, one row
+// per applied version.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Arbitrary key used with pg_advisory_lock so two instances of the app can't
+// migrate the DB at the same time.
+const lockKey = 73112023
+
+var ErrNoMigration = errors.New("migrate: No migration to roll back")
+
+// ErrNoTable is returned by Pending() when schema_migrations doesn't exist:
+// the DB has never been migrated.
+var ErrNoTable = errors.New("migrate: No schema_migrations table")
+
+// Migration is a pair of up/down SQL files sharing the same version.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a Migration with the date it was applied. Applied is zero if the
+// migration is still pending.
+type Status struct {
+	Migration
+	Applied time.Time
+}
+
+type Migrator struct {
+	DB     *pgxpool.Pool
+	Files  fs.FS
+	Logger *slog.Logger
+}
+
+// Load() reads every migration file of fsys and returns them ordered by
+// version. Each version must have an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, file := range files {
+		// 000001_create_source_table.up.sql
+		// |____| |_________________| |_|
+		// version       name       direction
+		base := strings.TrimSuffix(path.Base(file), ".sql")
+
+		dot := strings.LastIndex(base, ".")
+		under := strings.Index(base, "_")
+		if dot < 0 || under < 0 || under > dot {
+			return nil, fmt.Errorf("migrate: invalid file name %q", file)
+		}
+
+		version, err := strconv.Atoi(base[:under])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migrate: invalid version in %q", file)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: base[under+1 : dot]}
+			byVersion[version] = m
+		}
+
+		switch base[dot+1:] {
+		case "up":
+			m.Up = string(content)
+		case "down":
+			m.Down = string(content)
+		default:
+			return nil, fmt.Errorf("migrate: %q must end with .up.sql or .down.sql", file)
+		}
+	}
+
+	migrations := []Migration{}
+
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrate: version %d needs an up and a down file", m.Version)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(a, b int) bool {
+		return migrations[a].Version < migrations[b].Version
+	})
+
+	return migrations, nil
+}
+
+// Up() applies every pending migration in order, each one in its own
+// transaction. It returns the number of migrations applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	migrations, err := Load(m.Files)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+
+	for _, mig := range migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+
+		m.Logger.Info("migrating up", "version", mig.Version, "name", mig.Name)
+
+		err := m.run(ctx, conn, mig.Up,
+			"INSERT INTO schema_migrations (version, applied) VALUES ($1, $2)",
+			mig.Version, time.Now().UTC())
+		if err != nil {
+			return n, fmt.Errorf("migrate: version %d: %w", mig.Version, err)
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// Down() rolls back the last applied migration.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	migrations, err := Load(m.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		mig := migrations[i]
+
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+
+		m.Logger.Info("migrating down", "version", mig.Version, "name", mig.Name)
+
+		err := m.run(ctx, conn, mig.Down,
+			"DELETE FROM schema_migrations WHERE version = $1",
+			mig.Version)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: version %d: %w", mig.Version, err)
+		}
+
+		return &mig, nil
+	}
+
+	return nil, ErrNoMigration
+}
+
+// Status() returns every known migration with the date it was applied.
+// Nothing is written, every migration is pending if schema_migrations
+// doesn't exist yet.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	status, _, err := m.status(ctx)
+	return status, err
+}
+
+// Pending() returns the number of migrations not applied yet, or ErrNoTable.
+// It only reads the DB, so it can be called by the readiness probe.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	status, exists, err := m.status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, ErrNoTable
+	}
+
+	n := 0
+
+	for _, s := range status {
+		if s.Applied.IsZero() {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// status() is Status(), exists being false if schema_migrations doesn't
+// exist.
+func (m *Migrator) status(ctx context.Context) (status []Status, exists bool, err error) {
+	migrations, err := Load(m.Files)
+	if err != nil {
+		return nil, false, err
+	}
+
+	conn, err := m.DB.Acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Release()
+
+	err = conn.QueryRow(ctx,
+		"SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return nil, false, err
+	}
+
+	applied := map[int]time.Time{}
+
+	if exists {
+		applied, err = m.read(ctx, conn)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	status = []Status{}
+
+	for _, mig := range migrations {
+		status = append(status, Status{Migration: mig, Applied: applied[mig.Version]})
+	}
+
+	return status, exists, nil
+}
+
+// applied() creates schema_migrations if needed and returns the applied
+// versions with their date.
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int]time.Time, error) {
+	query := `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+       version integer PRIMARY KEY,
+       applied timestamp NOT NULL
+)
+`
+
+	_, err := conn.Exec(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.read(ctx, conn)
+}
+
+// read() returns the applied versions with their date, schema_migrations
+// must exist.
+func (m *Migrator) read(ctx context.Context, conn *pgxpool.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, "SELECT version, applied FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+
+	for rows.Next() {
+		var version int
+		var date time.Time
+
+		if err := rows.Scan(&version, &date); err != nil {
+			return nil, err
+		}
+
+		applied[version] = date
+	}
+
+	return applied, rows.Err()
+}
+
+// run() executes the migration SQL and the schema_migrations update in the
+// same transaction.
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, sql string,
+	record string, args ...any) error {
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (m *Migrator) lock(ctx context.Context) (*pgxpool.Conn, error) {
+	conn, err := m.DB.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (m *Migrator) unlock(conn *pgxpool.Conn) {
+	conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+	conn.Release()
+}
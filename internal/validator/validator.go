@@ -1,8 +1,11 @@
 package validator
 
 import (
+	"net/mail"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Regex for sanity checking the format of email adresses.
@@ -30,8 +33,13 @@ func (v *Validator) Valid() bool {
 }
 
 // Adds new error to the map (so long as no entrey already exists for the given
-// key)
+// key). The map is created on the first error, so a Validator embedded in a
+// form can be used without New().
 func (v *Validator) AddFieldError(key, message string) {
+	if v.FieldErrors == nil {
+		v.FieldErrors = make(map[string]string)
+	}
+
 	if _, exists := v.FieldErrors[key]; !exists {
 		v.FieldErrors[key] = message
 	}
@@ -54,3 +62,33 @@ func NotBlank(value string) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// IsEmail() returns true if value is a bare email address matching EmailRX
+// that net/mail, used to write the headers, parses as is.
+func IsEmail(value string) bool {
+	addr, err := mail.ParseAddress(value)
+	return err == nil && addr.Address == value && Matches(value, EmailRX)
+}
+
+// IsNumber() returns true if the value is an integer greater or equal to 0.
+func IsNumber(value string) bool {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	return err == nil && n >= 0
+}
+
+// IsDate() returns true if the value is a valid date in the given layout.
+func IsDate(value, layout string) bool {
+	_, err := time.Parse(layout, strings.TrimSpace(value))
+	return err == nil
+}
+
+// PermittedValue() returns true if value is one of the permitted values.
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	for _, p := range permittedValues {
+		if value == p {
+			return true
+		}
+	}
+
+	return false
+}
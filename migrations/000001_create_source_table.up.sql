@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS source (
+       id            serial PRIMARY KEY,
+       name          text NOT NULL UNIQUE,
+       code_GMAO     text,
+       -- Number of days a resolved info stays visible before beeing
+       -- archived. NULL means the global value (-archive-after flag) is used.
+       archive_after integer,
+       created       timestamp NOT NULL
+);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS info (
+       id        serial PRIMARY KEY,
+       source_id integer NOT NULL REFERENCES source (id),
+       agent     text NOT NULL,
+       material  text NOT NULL,
+       detail    text NOT NULL,
+       event     text NOT NULL,
+       priority  integer NOT NULL,
+       status    text NOT NULL,
+       target    text,
+       rte       text,
+       ais       text,
+       estimate  text,
+       brips     text,
+       oups      text,
+       ameps     text,
+       doneby    text,
+       day_done  text,
+       created   timestamp NOT NULL,
+       updated   timestamp,
+       -- Incremented on each update. Used to detect two users editing the
+       -- same info at the same time.
+       version   integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS info_source_id_idx ON info (source_id);
+CREATE INDEX IF NOT EXISTS info_status_idx ON info (status);
@@ -0,0 +1,13 @@
+-- Every automatic or manual action made on an info is logged here so it can
+-- be traced back later. No foreign key: the history stays when an info is
+-- deleted.
+CREATE TABLE IF NOT EXISTS history (
+       id        serial PRIMARY KEY,
+       info_id   integer NOT NULL,
+       source_id integer NOT NULL,
+       action    text NOT NULL,
+       detail    text,
+       created   timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS history_info_id_idx ON history (info_id);
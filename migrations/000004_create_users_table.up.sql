@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS users (
+       id      serial PRIMARY KEY,
+       name    text NOT NULL,
+       email   text NOT NULL DEFAULT '',
+       created timestamp NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_name_idx ON users (lower(name));
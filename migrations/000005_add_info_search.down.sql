@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS info_search_idx;
+ALTER TABLE info DROP COLUMN IF EXISTS search;
+DROP TEXT SEARCH CONFIGURATION IF EXISTS french_unaccent;
@@ -0,0 +1,27 @@
+-- Full-text search on the infos. The french_unaccent configuration removes
+-- the accents before the French stemming, so "défaut", "defaut" and
+-- "défauts" all match.
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+DO $$
+BEGIN
+       IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'french_unaccent') THEN
+              CREATE TEXT SEARCH CONFIGURATION french_unaccent (COPY = french);
+              ALTER TEXT SEARCH CONFIGURATION french_unaccent
+                    ALTER MAPPING FOR hword, hword_part, word
+                    WITH unaccent, french_stem;
+       END IF;
+END
+$$;
+
+-- The weight gives the rank: a match in material counts more than one in
+-- detail or agent.
+ALTER TABLE info ADD COLUMN IF NOT EXISTS search tsvector
+      GENERATED ALWAYS AS (
+            setweight(to_tsvector('french_unaccent', material), 'A') ||
+            setweight(to_tsvector('french_unaccent', event), 'B') ||
+            setweight(to_tsvector('french_unaccent', detail), 'C') ||
+            setweight(to_tsvector('french_unaccent', agent), 'D')
+      ) STORED;
+
+CREATE INDEX IF NOT EXISTS info_search_idx ON info USING gin (search);
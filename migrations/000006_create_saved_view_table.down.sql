@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS saved_view;
+ALTER TABLE users DROP COLUMN IF EXISTS team;
@@ -0,0 +1,19 @@
+-- Team of the user, given by the reverse proxy. The views shared by a user
+-- are visible to the users of the same team.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS team text NOT NULL DEFAULT '';
+
+-- Named filters of the sourceView page. query is the query string of the
+-- filters (status=affecté&priority=1...). A pinned view is displayed on the
+-- home page of its owner, and of the team if it's shared.
+CREATE TABLE IF NOT EXISTS saved_view (
+       id        serial PRIMARY KEY,
+       user_id   integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+       source_id integer NOT NULL REFERENCES source (id) ON DELETE CASCADE,
+       name      text NOT NULL,
+       query     text NOT NULL,
+       pinned    boolean NOT NULL DEFAULT false,
+       shared    boolean NOT NULL DEFAULT false,
+       created   timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS saved_view_user_id_idx ON saved_view (user_id);
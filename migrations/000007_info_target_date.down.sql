@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS info_target_idx;
+
+ALTER TABLE info
+      ALTER COLUMN target TYPE text
+      USING to_char(target, 'YYYY-MM-DD');
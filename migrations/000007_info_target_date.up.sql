@@ -0,0 +1,36 @@
+-- target was free text. The ISO (2024-05-31) and French (31/05/2024) dates
+-- are converted, any other text is kept at the end of the detail so it isn't
+-- lost. So is an impossible date like 2024-02-30: to_date() raises an error
+-- for it, info_target_to_date() returns NULL instead.
+CREATE OR REPLACE FUNCTION info_target_to_date(target text) RETURNS date AS $$
+BEGIN
+       target := btrim(target);
+
+       IF target ~ '^\d{4}-\d{2}-\d{2}$' THEN
+              RETURN to_date(target, 'YYYY-MM-DD');
+       ELSIF target ~ '^\d{2}/\d{2}/\d{4}$' THEN
+              RETURN to_date(target, 'DD/MM/YYYY');
+       END IF;
+
+       RETURN NULL;
+EXCEPTION
+       -- datetime_field_overflow, invalid_datetime_format...
+       WHEN data_exception THEN
+              RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+UPDATE info
+   SET detail = detail || E'\n\nÉchéance : ' || target
+ WHERE target IS NOT NULL AND
+       btrim(target) <> '' AND
+       info_target_to_date(target) IS NULL;
+
+ALTER TABLE info
+      ALTER COLUMN target TYPE date
+      USING info_target_to_date(target);
+
+DROP FUNCTION info_target_to_date(text);
+
+-- Used by the overdue counts and filters.
+CREATE INDEX IF NOT EXISTS info_target_idx ON info (target);
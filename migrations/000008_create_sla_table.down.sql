@@ -0,0 +1,2 @@
+ALTER TABLE info DROP COLUMN IF EXISTS resolved;
+DROP TABLE IF EXISTS sla;
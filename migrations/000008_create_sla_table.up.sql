@@ -0,0 +1,46 @@
+-- Days given to fix an info, by priority. The rows without source_id are the
+-- defaults, a row with a source_id overrides the default for that source.
+CREATE TABLE IF NOT EXISTS sla (
+       id        serial PRIMARY KEY,
+       source_id integer REFERENCES source (id) ON DELETE CASCADE,
+       priority  integer NOT NULL,
+       days      integer NOT NULL CHECK (days > 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS sla_default_idx
+       ON sla (priority) WHERE source_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS sla_source_idx
+       ON sla (source_id, priority) WHERE source_id IS NOT NULL;
+
+INSERT INTO sla (priority, days)
+VALUES (1, 7), (2, 30), (3, 90), (4, 180)
+    ON CONFLICT DO NOTHING;
+
+-- When the info was resolved, to know if its target was met. The resolved
+-- infos already there get their day_done, or their last update if day_done
+-- isn't a date: free text or an impossible date like 31/02/2023, for which
+-- to_date() raises an error and info_day_done_to_date() returns NULL.
+ALTER TABLE info ADD COLUMN IF NOT EXISTS resolved timestamp;
+
+CREATE OR REPLACE FUNCTION info_day_done_to_date(day_done text) RETURNS date AS $$
+BEGIN
+       day_done := btrim(day_done);
+
+       IF day_done ~ '^\d{2}/\d{2}/\d{4}$' THEN
+              RETURN to_date(day_done, 'DD/MM/YYYY');
+       END IF;
+
+       RETURN NULL;
+EXCEPTION
+       -- datetime_field_overflow, invalid_datetime_format...
+       WHEN data_exception THEN
+              RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+UPDATE info
+   SET resolved = COALESCE(info_day_done_to_date(day_done), updated, created)
+ WHERE status IN ('résolu', 'archivé') AND
+       resolved IS NULL;
+
+DROP FUNCTION info_day_done_to_date(text);
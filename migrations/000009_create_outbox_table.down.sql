@@ -0,0 +1,5 @@
+ALTER TABLE info DROP COLUMN IF EXISTS overdue_notified;
+ALTER TABLE users DROP COLUMN IF EXISTS notify_resolved;
+ALTER TABLE users DROP COLUMN IF EXISTS notify_overdue;
+ALTER TABLE users DROP COLUMN IF EXISTS notify_assigned;
+DROP TABLE IF EXISTS outbox;
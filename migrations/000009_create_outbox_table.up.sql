@@ -0,0 +1,29 @@
+-- Emails waiting to be sent. They are rendered when queued, the worker only
+-- sends them and retries on failure until max attempts is reached.
+CREATE TABLE IF NOT EXISTS outbox (
+       id           serial PRIMARY KEY,
+       recipient    text NOT NULL,
+       subject      text NOT NULL,
+       text_body    text NOT NULL,
+       html_body    text NOT NULL,
+       -- info_assigned, info_overdue, info_resolved...
+       kind         text NOT NULL,
+       attempts     integer NOT NULL DEFAULT 0,
+       next_attempt timestamp NOT NULL,
+       last_error   text NOT NULL DEFAULT '',
+       sent         timestamp,
+       created      timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx
+       ON outbox (next_attempt) WHERE sent IS NULL;
+
+-- Emails each user wants to receive. The assignee gets the assigned infos,
+-- the planners choose the overdue and resolved ones.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_assigned boolean NOT NULL DEFAULT true;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_overdue boolean NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_resolved boolean NOT NULL DEFAULT false;
+
+-- When the overdue email of the info was queued, so it's only sent once.
+-- Reset when the target changes.
+ALTER TABLE info ADD COLUMN IF NOT EXISTS overdue_notified timestamp;
@@ -0,0 +1,6 @@
+-- Summary of the sources sent by email: '' (none), 'daily' or 'weekly'.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS digest text NOT NULL DEFAULT ''
+      CHECK (digest IN ('', 'daily', 'weekly'));
+
+-- When the last digest of the user was queued, so each one is only sent once.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS digest_sent timestamp;
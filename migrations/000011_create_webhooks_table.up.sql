@@ -0,0 +1,31 @@
+-- Webhooks called on the changes of the infos and sources. events holds the
+-- events wanted (info.created, source.deleted...), empty for all of them.
+-- The payloads are signed with secret (HMAC-SHA256).
+CREATE TABLE IF NOT EXISTS webhook (
+       id      serial PRIMARY KEY,
+       url     text NOT NULL,
+       secret  text NOT NULL,
+       events  text[] NOT NULL DEFAULT '{}',
+       active  boolean NOT NULL DEFAULT true,
+       created timestamp NOT NULL
+);
+
+-- Each call of a webhook, kept as a log. Same retries as the outbox:
+-- attempts and next_attempt until delivered is set.
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+       id           serial PRIMARY KEY,
+       webhook_id   integer NOT NULL REFERENCES webhook ON DELETE CASCADE,
+       event        text NOT NULL,
+       payload      text NOT NULL,
+       attempts     integer NOT NULL DEFAULT 0,
+       next_attempt timestamp NOT NULL,
+       status_code  integer NOT NULL DEFAULT 0,
+       last_error   text NOT NULL DEFAULT '',
+       delivered    timestamp,
+       created      timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_pending_idx
+       ON webhook_delivery (next_attempt) WHERE delivered IS NULL;
+CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_idx
+       ON webhook_delivery (webhook_id, id);
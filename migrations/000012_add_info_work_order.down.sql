@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS info_work_order_idx;
+ALTER TABLE info DROP COLUMN IF EXISTS work_order;
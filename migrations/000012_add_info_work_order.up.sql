@@ -0,0 +1,6 @@
+-- ID of the work order of the info in the GMAO, set once it's pushed by the
+-- GMAO connector.
+ALTER TABLE info ADD COLUMN IF NOT EXISTS work_order text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS info_work_order_idx
+       ON info (work_order) WHERE work_order IS NOT NULL;
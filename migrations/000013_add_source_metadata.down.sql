@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS source_code_gmao_idx;
+ALTER TABLE source
+      DROP CONSTRAINT IF EXISTS source_coordinates_check,
+      DROP COLUMN IF EXISTS voltage_kv,
+      DROP COLUMN IF EXISTS address,
+      DROP COLUMN IF EXISTS latitude,
+      DROP COLUMN IF EXISTS longitude,
+      DROP COLUMN IF EXISTS team,
+      DROP COLUMN IF EXISTS notes;
@@ -0,0 +1,33 @@
+-- code_GMAO was never set from the UI, but it may have been filled by hand.
+-- The codes are stored upper-case, an empty one is NULL.
+UPDATE source
+   SET code_GMAO = NULLIF(upper(btrim(code_GMAO)), '')
+ WHERE code_GMAO IS NOT NULL;
+
+-- Metadata of the source, edited with the source forms.
+ALTER TABLE source
+      -- Voltage level in kV.
+      ADD COLUMN IF NOT EXISTS voltage_kv integer CHECK (voltage_kv > 0),
+      ADD COLUMN IF NOT EXISTS address    text NOT NULL DEFAULT '',
+      ADD COLUMN IF NOT EXISTS latitude   double precision
+          CHECK (latitude BETWEEN -90 AND 90),
+      ADD COLUMN IF NOT EXISTS longitude  double precision
+          CHECK (longitude BETWEEN -180 AND 180),
+      -- Team responsible for the source.
+      ADD COLUMN IF NOT EXISTS team       text NOT NULL DEFAULT '',
+      ADD COLUMN IF NOT EXISTS notes      text NOT NULL DEFAULT '',
+      ADD CONSTRAINT source_coordinates_check
+          CHECK ((latitude IS NULL) = (longitude IS NULL));
+
+-- A GMAO code is unique, only the first source keeps a duplicated one, the
+-- others get it in their notes so it isn't lost.
+UPDATE source AS s
+   SET notes = 'Code GMAO : ' || s.code_GMAO,
+       code_GMAO = NULL
+ WHERE EXISTS (SELECT 1
+                 FROM source AS o
+                WHERE o.code_GMAO = s.code_GMAO AND
+                      o.id < s.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS source_code_gmao_idx
+       ON source (code_GMAO) WHERE code_GMAO IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS info_equipment_idx;
+ALTER TABLE info DROP COLUMN IF EXISTS equipment_id;
+DROP TABLE IF EXISTS equipment;
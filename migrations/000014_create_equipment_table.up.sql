@@ -0,0 +1,25 @@
+-- Catalogue of the equipment of each source (transformers, breakers...). A
+-- curatif may point to one, so the curatifs can be counted per equipment
+-- whatever the way its material was typed.
+CREATE TABLE IF NOT EXISTS equipment (
+       id           serial PRIMARY KEY,
+       source_id    integer NOT NULL REFERENCES source ON DELETE CASCADE,
+       name         text NOT NULL,
+       bay          text NOT NULL DEFAULT '',
+       type         text NOT NULL DEFAULT '',
+       manufacturer text NOT NULL DEFAULT '',
+       serial       text NOT NULL DEFAULT '',
+       commissioned date,
+       created      timestamp NOT NULL
+);
+
+-- The name is what the curatif form autocompletes, it's unique in a source
+-- whatever the case.
+CREATE UNIQUE INDEX IF NOT EXISTS equipment_name_idx
+       ON equipment (source_id, lower(name));
+
+ALTER TABLE info
+      ADD COLUMN IF NOT EXISTS equipment_id integer
+          REFERENCES equipment ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS info_equipment_idx ON info (equipment_id);
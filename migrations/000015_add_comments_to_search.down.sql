@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS info_search_idx;
+ALTER TABLE info DROP COLUMN IF EXISTS search;
+
+ALTER TABLE info ADD COLUMN search tsvector
+      GENERATED ALWAYS AS (
+            setweight(to_tsvector('french_unaccent', material), 'A') ||
+            setweight(to_tsvector('french_unaccent', event), 'B') ||
+            setweight(to_tsvector('french_unaccent', detail), 'C') ||
+            setweight(to_tsvector('french_unaccent', agent), 'D')
+      ) STORED;
+
+CREATE INDEX IF NOT EXISTS info_search_idx ON info USING gin (search);
@@ -0,0 +1,11 @@
+// Package migrations holds the SQL files of the DB schema. They are embedded
+// in the binary and applied by internal/migrate.
+//
+// File names follow: <version>_<name>.<up|down>.sql
+// Exemple: 000001_create_source_table.up.sql
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
@@ -0,0 +1,250 @@
+package migrations_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"e-curatif/internal/migrate"
+	"e-curatif/migrations"
+)
+
+// Same variable as the conformance tests of internal/data. The migrations
+// run in their own schema, dropped at the end.
+const testDSNEnv = "ECURATIF_TEST_DSN"
+
+const testSchema = "ecuratif_migrations_test"
+
+// migrator() returns a Migrator of the migrations up to version.
+func migrator(t *testing.T, db *pgxpool.Pool, version int) *migrate.Migrator {
+	t.Helper()
+
+	files := fstest.MapFS{}
+
+	names, err := fs.Glob(migrations.Files, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		v, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil || v > version {
+			continue
+		}
+
+		b, err := fs.ReadFile(migrations.Files, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[name] = &fstest.MapFile{Data: b}
+	}
+
+	return &migrate.Migrator{
+		DB:     db,
+		Files:  files,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// openTestDB() connects to an empty testSchema. With public, the extensions
+// (unaccent) are found but so is the schema_migrations of the DB.
+func openTestDB(t *testing.T, public bool) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", testDSNEnv)
+	}
+
+	ctx := context.Background()
+
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	for _, query := range []string{
+		"DROP SCHEMA IF EXISTS " + testSchema + " CASCADE",
+		"CREATE SCHEMA " + testSchema,
+	} {
+		if _, err := admin.Exec(ctx, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.ConnConfig.RuntimeParams["search_path"] = testSchema
+	if public {
+		cfg.ConnConfig.RuntimeParams["search_path"] = testSchema + ", public"
+	}
+
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Exec(context.Background(), "DROP SCHEMA IF EXISTS "+testSchema+" CASCADE")
+		db.Close()
+	})
+
+	return db
+}
+
+// The free text dates of the legacy infos don't stop the migrations: the
+// target (000007) and day_done (000008) which aren't dates, or impossible
+// ones, are kept in the detail or replaced by the last update.
+func TestLegacyDates(t *testing.T) {
+	db := openTestDB(t, true)
+	ctx := context.Background()
+
+	if _, err := migrator(t, db, 6).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2023, time.January, 10, 8, 0, 0, 0, time.UTC)
+	updated := time.Date(2023, time.March, 20, 9, 0, 0, 0, time.UTC)
+
+	_, err := db.Exec(ctx, `INSERT INTO source (name, created) VALUES ('Lyon', $1)`,
+		created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos := []struct {
+		status  string
+		target  string
+		dayDone string
+
+		wantTarget   string // YYYY-MM-DD, "" for NULL
+		wantDetail   string
+		wantResolved string // YYYY-MM-DD, "" for NULL
+	}{
+		{"en attente", "2024-05-31", "", "2024-05-31", "fuite", ""},
+		{"en attente", " 31/05/2024 ", "", "2024-05-31", "fuite", ""},
+		{"en attente", "2024-02-30", "", "",
+			"fuite\n\nÉchéance : 2024-02-30", ""},
+		{"en attente", "31/02/2024", "", "",
+			"fuite\n\nÉchéance : 31/02/2024", ""},
+		{"en attente", "semaine 12", "", "",
+			"fuite\n\nÉchéance : semaine 12", ""},
+		{"résolu", "", "15/03/2023", "", "fuite", "2023-03-15"},
+		{"résolu", "", "31/02/2023", "", "fuite", "2023-03-20"},
+		{"archivé", "", "45/13/2022", "", "fuite", "2023-03-20"},
+		{"résolu", "", "hier", "", "fuite", "2023-03-20"},
+	}
+
+	for _, i := range infos {
+		query := `
+INSERT INTO info (source_id, agent, material, detail, event, priority, status,
+                  target, day_done, created, updated)
+VALUES (1, 'dupont', 'TR 1', 'fuite', 'ronde', 2, $1, NULLIF($2, ''),
+        NULLIF($3, ''), $4, $5)
+`
+
+		_, err := db.Exec(ctx, query, i.status, i.target, i.dayDone, created,
+			updated)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := migrator(t, db, 8).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	query := `
+SELECT COALESCE(to_char(target, 'YYYY-MM-DD'), ''), detail,
+       COALESCE(to_char(resolved, 'YYYY-MM-DD'), '')
+  FROM info
+ ORDER BY id
+`
+
+	rows, err := db.Query(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	n := 0
+
+	for ; rows.Next(); n++ {
+		var target, detail, resolved string
+
+		if err := rows.Scan(&target, &detail, &resolved); err != nil {
+			t.Fatal(err)
+		}
+
+		want := infos[n]
+		got := fmt.Sprintf("%q %q %q", target, detail, resolved)
+
+		if got != fmt.Sprintf("%q %q %q", want.wantTarget, want.wantDetail,
+			want.wantResolved) {
+
+			t.Errorf("target %q, day_done %q: got %s", want.target,
+				want.dayDone, got)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(infos) {
+		t.Errorf("got %d infos, want %d", n, len(infos))
+	}
+
+	// And the next ones apply too.
+	if _, err := migrator(t, db, 1<<30).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Pending() is called by /readyz: it must not create schema_migrations.
+func TestPendingReadOnly(t *testing.T) {
+	db := openTestDB(t, false)
+	ctx := context.Background()
+
+	m := migrator(t, db, 2)
+
+	if _, err := m.Pending(ctx); !errors.Is(err, migrate.ErrNoTable) {
+		t.Fatalf("got %v, want %v", err, migrate.ErrNoTable)
+	}
+
+	var exists bool
+
+	err := db.QueryRow(ctx,
+		"SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists {
+		t.Fatal("schema_migrations created by Pending()")
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := m.Pending(ctx); err != nil || n != 0 {
+		t.Errorf("after Up(): got %d pending (%v), want 0", n, err)
+	}
+}
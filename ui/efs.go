@@ -0,0 +1,11 @@
+// Package ui holds the HTML templates and the static files (CSS, JS, images).
+// They are embedded in the binary so it can run from any directory.
+package ui
+
+import "embed"
+
+// Files contains html/ and static/. In development the app can read the same
+// tree from disk instead (see -ui-dir).
+//
+//go:embed "html" "static"
+var Files embed.FS
@@ -0,0 +1,65 @@
+// Tiny chart library: horizontal bar charts drawn in SVG, without any
+// dependency so it works on the internal network.
+var Chart = (function () {
+    var NS = "http://www.w3.org/2000/svg";
+
+    function node(name, attrs) {
+        var el = document.createElementNS(NS, name);
+        Object.keys(attrs).forEach(function (k) {
+            el.setAttribute(k, attrs[k]);
+        });
+        return el;
+    }
+
+    // fromTable() reads the points from the rows having data-label and
+    // data-value attributes.
+    function fromTable(table) {
+        var points = [];
+        table.querySelectorAll("tr[data-label]").forEach(function (tr) {
+            points.push({
+                label: tr.dataset.label,
+                value: Number(tr.dataset.value) || 0
+            });
+        });
+        return points;
+    }
+
+    // bars() draws one bar per point inside el.
+    function bars(el, points) {
+        if (points.length === 0) {
+            return;
+        }
+
+        var rowHeight = 22, labelWidth = 160, width = 640;
+        var max = Math.max.apply(null, points.map(function (p) {
+            return p.value;
+        })) || 1;
+
+        var svg = node("svg", {
+            viewBox: "0 0 " + width + " " + points.length * rowHeight,
+            width: "100%",
+            role: "img"
+        });
+
+        points.forEach(function (p, i) {
+            var y = i * rowHeight;
+            var w = (width - labelWidth - 40) * p.value / max;
+
+            var label = node("text", {x: 0, y: y + 15});
+            label.textContent = p.label;
+            svg.appendChild(label);
+
+            svg.appendChild(node("rect", {
+                x: labelWidth, y: y + 3, width: w, height: rowHeight - 6
+            }));
+
+            var value = node("text", {x: labelWidth + w + 6, y: y + 15});
+            value.textContent = p.value;
+            svg.appendChild(value);
+        });
+
+        el.appendChild(svg);
+    }
+
+    return {bars: bars, fromTable: fromTable};
+})();
@@ -0,0 +1,7 @@
+// Development only: reloads the page when a file of ui/ changes on disk.
+(function () {
+    var source = new EventSource("/dev/reload");
+    source.addEventListener("reload", function () {
+        window.location.reload();
+    });
+})();
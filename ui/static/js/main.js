@@ -0,0 +1,17 @@
+// Asks for a confirmation before submitting a form whose button has a
+// data-confirm attribute (deletions...).
+document.querySelectorAll("[data-confirm]").forEach(function (button) {
+    button.addEventListener("click", function (e) {
+        if (!window.confirm(button.dataset.confirm)) {
+            e.preventDefault();
+        }
+    });
+});
+
+// Draws the charts of the page, see chart.js.
+document.querySelectorAll("[data-chart]").forEach(function (el) {
+    var table = document.getElementById(el.dataset.chart);
+    if (table) {
+        Chart.bars(el, Chart.fromTable(table));
+    }
+});